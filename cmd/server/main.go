@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/evenstarw1/theme-park-data/pkg/config"
+	"github.com/evenstarw1/theme-park-data/pkg/themepark"
+)
+
+// main arranca el servidor HTTP que se usa con Docker, fuera de Vercel
+func main() {
+	config := config.FromEnv()
+
+	// Conecta con la base de datos una sola vez para todo el proceso
+	databaseStore, err := themepark.NewDatabaseStore(config.DatabaseConnectionString, config.DatabasePool)
+	if err != nil {
+		log.Fatalf("Error al conectar con la base de datos: %v", err)
+	}
+	defer databaseStore.Close()
+
+	// Inicializa el router con todas las rutas
+	routerOptions, err := config.RouterOptions()
+	if err != nil {
+		log.Fatalf("Error en la configuración: %v", err)
+	}
+	// Con tokens firmados, las versiones revocadas se recargan en segundo plano para no consultar la base de
+	// datos en cada petición
+	var tokenVersions *themepark.TokenVersions
+	if config.SigningKeys != "" {
+		tokenVersions = themepark.NewTokenVersions(databaseStore, config.AccessTokenTTL)
+		routerOptions = append(routerOptions, themepark.WithTokenVersions(tokenVersions))
+	}
+	router := themepark.NewRouter(databaseStore, routerOptions...)
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", config.ListeningPort),
+		Handler: router,
+	}
+
+	// Escucha SIGTERM (docker stop) y SIGINT (Ctrl+C) para parar de forma ordenada
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	// Borra periódicamente los tokens caducados hasta que se pare el servidor
+	themepark.StartTokenCleanup(ctx, databaseStore, config.TokenCleanupInterval)
+	if tokenVersions != nil {
+		themepark.StartTokenVersionRefresh(ctx, tokenVersions, config.TokenVersionRefresh)
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Escuchando en el puerto %d", config.ListeningPort)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Error en el servidor: %v", err)
+		}
+	case <-ctx.Done():
+		log.Printf("Parando el servidor, esperando a las peticiones en curso...")
+	}
+
+	// Deja de aceptar conexiones y espera a que terminen las peticiones en curso
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error al parar el servidor: %v", err)
+	}
+}
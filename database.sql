@@ -10,6 +10,7 @@ CREATE TABLE themeparks (
     location POINT NOT NULL,
     description TEXT NOT NULL,
     picture TEXT NOT NULL,
+    time_zone TEXT NOT NULL DEFAULT 'UTC', -- IANA time zone of the park, e.g. Europe/Madrid
     created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     CONSTRAINT unique_name UNIQUE (name)
 );
@@ -31,23 +32,73 @@ CREATE TABLE attractions (
     id INT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
     themepark_id INT REFERENCES themeparks (id) ON UPDATE CASCADE ON DELETE CASCADE,
     name TEXT NOT NULL,
+    type TEXT NOT NULL DEFAULT 'other' CHECK (type IN ('coaster', 'water_ride', 'dark_ride', 'flat_ride', 'drop_tower', 'kids_ride', 'show', 'other')),
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'closed', 'maintenance', 'seasonal')),
+    min_height_cm INT, -- Restrictions and figures are NULL when unknown
+    max_height_cm INT,
+    min_age INT,
+    thrill_level INT CHECK (thrill_level BETWEEN 1 AND 5), -- 1 gentle to 5 extreme
+    duration_seconds INT,
+    capacity_per_hour INT,
+    wheelchair_accessible BOOLEAN NOT NULL DEFAULT FALSE,
+    transfer_required BOOLEAN NOT NULL DEFAULT FALSE,
+    companion_required BOOLEAN NOT NULL DEFAULT FALSE,
+    sensory_friendly BOOLEAN NOT NULL DEFAULT FALSE,
     created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
 
+CREATE TABLE park_weekly_hours ( -- Regular opening hours of the parks, several per weekday for split hours
+    id INT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    themepark_id INT NOT NULL REFERENCES themeparks (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    weekday INT NOT NULL CHECK (weekday BETWEEN 0 AND 6), -- 0 is Sunday
+    opens TIME NOT NULL,
+    closes TIME NOT NULL CHECK (closes > opens)
+);
+
+CREATE TABLE park_date_hours ( -- Opening hours of a date replacing the weekly ones, NULL hours if closed
+    id INT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    themepark_id INT NOT NULL REFERENCES themeparks (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    date DATE NOT NULL,
+    opens TIME,
+    closes TIME CHECK (closes > opens),
+    note TEXT NOT NULL DEFAULT '',
+    CHECK ((opens IS NULL) = (closes IS NULL))
+);
+
+CREATE INDEX park_date_hours_themepark_id_idx ON park_date_hours (themepark_id, date);
+
+CREATE TABLE ticket_prices ( -- Prices per ticket tier, NULL dates are open ended. Tiers don't overlap in time.
+    id INT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    themepark_id INT NOT NULL REFERENCES themeparks (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    tier TEXT NOT NULL CHECK (tier IN ('adult', 'child', 'senior', 'season_pass')),
+    amount_cents BIGINT NOT NULL CHECK (amount_cents >= 0), -- In the minor unit of the currency
+    currency TEXT NOT NULL CHECK (currency ~ '^[A-Z]{3}$'), -- ISO 4217
+    valid_from DATE,
+    valid_to DATE CHECK (valid_to >= valid_from),
+    created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX ticket_prices_themepark_id_idx ON ticket_prices (themepark_id, tier);
+
 CREATE TABLE users (
     id INT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
     name TEXT NOT NULL,
-    email TEXT NOT NULL,
-    password TEXT NOT NULL, -- SHA256 from the actual password
-    access_level INT NOT NULL, -- 1 Admin, 2 normal user
+    email TEXT NOT NULL CHECK (email = lower(trim(email))), -- Normalized by the app, so lookups ignore the case
+    password TEXT NOT NULL, -- argon2id hash ($argon2id$v=19$m=...,t=...,p=...$salt$hash). Legacy rows hold an unsalted SHA256 hex digest, upgraded on the next login
+    access_level INT NOT NULL, -- 1 Admin, 2 normal user, 3 park moderator
     birth_date DATE NOT NULL,
     city TEXT NOT NULL,
     profile_picture TEXT, -- link to it?
     description TEXT NOT NULL,
+    email_verified TIMESTAMP WITH TIME ZONE, -- NULL while the user hasn't confirmed the email, and can't log in
+    token_version INT NOT NULL DEFAULT 0, -- In the signed access tokens, bumped to revoke them
+    tokens_revoked TIMESTAMP WITH TIME ZONE, -- Last time token_version was bumped, to reload only the recent ones
     created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     CONSTRAINT unique_email UNIQUE (email)
 );
 
+CREATE INDEX users_tokens_revoked_idx ON users (tokens_revoked);
+
 CREATE TABLE users_categories (
      id INT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
      user_id INT REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
@@ -57,11 +108,18 @@ CREATE TABLE users_categories (
 
 CREATE TABLE tokens (
     id INT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
-    token TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE, -- SHA256 hex of the token given to the user, the token itself is never stored
     user_id INT REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
-    created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+    created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires TIMESTAMP WITH TIME ZONE NOT NULL, -- IsLoggedIn rejects the token after this, and the cleanup job removes it
+    family UUID NOT NULL, -- Tokens of the same session: the ones given at login and all the ones refreshed from them
+    refresh BOOLEAN NOT NULL DEFAULT FALSE, -- Refresh tokens only get new tokens, they aren't valid for IsLoggedIn
+    used TIMESTAMP WITH TIME ZONE -- When a refresh token was rotated. Using it again revokes the whole family
 );
 
+CREATE INDEX tokens_expires_idx ON tokens (expires);
+CREATE INDEX tokens_family_idx ON tokens (family);
+
 CREATE TABLE comments (
     id INT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
     user_id INT REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
@@ -70,8 +128,46 @@ CREATE TABLE comments (
     created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
 
+CREATE TABLE wait_time_reports ( -- Wait times reported by the users, averaged by the app
+    id INT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    attraction_id INT NOT NULL REFERENCES attractions (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    user_id INT REFERENCES users (id) ON UPDATE CASCADE ON DELETE SET NULL,
+    wait_minutes INT NOT NULL CHECK (wait_minutes BETWEEN 0 AND 600),
+    created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX wait_time_reports_attraction_id_idx ON wait_time_reports (attraction_id, created);
+
+CREATE TABLE user_tokens ( -- One-time tokens sent by email, deleted once used
+    id INT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    user_id INT NOT NULL REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    purpose TEXT NOT NULL, -- verify_email or reset_password
+    token_hash TEXT NOT NULL UNIQUE, -- SHA256 hex of the token in the link
+    expires TIMESTAMP WITH TIME ZONE NOT NULL,
+    created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX user_tokens_user_id_idx ON user_tokens (user_id, purpose, created);
+
+CREATE TABLE login_failures ( -- Failed logins per account and per IP, to slow down password guessing
+    key TEXT PRIMARY KEY, -- email:<email> or ip:<address>
+    failures INT NOT NULL,
+    last_failure TIMESTAMP WITH TIME ZONE NOT NULL,
+    locked_until TIMESTAMP WITH TIME ZONE -- Logins for the key are rejected until then
+);
+
+CREATE TABLE role_changes ( -- Audit of the access level changes made by admins
+    id INT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    user_id INT NOT NULL REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    changed_by INT REFERENCES users (id) ON UPDATE CASCADE ON DELETE SET NULL, -- Admin who made the change
+    old_access_level INT NOT NULL,
+    new_access_level INT NOT NULL,
+    created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
 
 -- Test dataset data
+-- N.B: Test users keep legacy SHA256 passwords, so they also exercise the upgrade to argon2id on login.
 
 INSERT INTO themeparks (id, name, location, description, picture)
 VALUES
@@ -98,14 +194,45 @@ VALUES
     (7,3,1); -- Port Aventura only 1 (thrilling)
 
 
-INSERT INTO attractions (id, themepark_id, name)
+INSERT INTO attractions (id, themepark_id, name, type, min_height_cm, thrill_level)
+VALUES
+     (1, 1, 'La lanzadera', 'drop_tower', 140, 5), -- Belongs to PAM
+     (2, 1, 'El tornado', 'coaster', 120, 4), -- Belongs to PAM
+     (3, 2, 'Stunt Fall', 'coaster', 122, 5), -- Belongs to Warner
+     (4, 2, 'Batman returns', 'coaster', 120, 4), -- Belongs to Warner
+     (5, 3, 'Shambala', 'coaster', 140, 5), -- Belongs to Port Aventura
+     (6, 3, 'Dragon Khan', 'coaster', 140, 5); -- Belongs to Port Aventura
+
+UPDATE themeparks SET time_zone = 'Europe/Madrid';
+
+INSERT INTO park_weekly_hours (id, themepark_id, weekday, opens, closes)
 VALUES
-     (1, 1, 'La lanzadera'), -- Belongs to PAM
-     (2, 1, 'El tornado'), -- Belongs to PAM
-     (3, 2, 'Stunt Fall'), -- Belongs to Warner
-     (4, 2, 'Batman returns'), -- Belongs to Warner
-     (5, 3, 'Shambala'), -- Belongs to Port Aventura
-     (6, 3, 'Dragon Khan'); -- Belongs to Port Aventura
+    (1, 1, 5, '12:00', '22:00'), -- PAM opens Friday to Sunday
+    (2, 1, 6, '11:00', '23:00'),
+    (3, 1, 0, '11:00', '21:00'),
+    (4, 3, 1, '10:00', '20:00'), -- Port Aventura opens every day
+    (5, 3, 2, '10:00', '20:00'),
+    (6, 3, 3, '10:00', '20:00'),
+    (7, 3, 4, '10:00', '20:00'),
+    (8, 3, 5, '10:00', '24:00'),
+    (9, 3, 6, '10:00', '24:00'),
+    (10, 3, 0, '10:00', '20:00');
+
+INSERT INTO park_date_hours (id, themepark_id, date, opens, closes, note)
+VALUES
+    (1, 1, '2024-12-25', NULL, NULL, 'Cerrado por Navidad'), -- PAM closes on Christmas
+    (2, 3, '2024-12-24', '10:00', '17:00', 'Nochebuena'); -- Port Aventura closes early on Christmas Eve
+
+INSERT INTO ticket_prices (id, themepark_id, tier, amount_cents, currency)
+VALUES
+    (1, 1, 'adult', 3990, 'EUR'), -- PAM
+    (2, 1, 'child', 3190, 'EUR'),
+    (3, 1, 'senior', 990, 'EUR'),
+    (4, 2, 'adult', 4900, 'EUR'), -- Warner
+    (5, 2, 'child', 4100, 'EUR'),
+    (6, 3, 'adult', 6000, 'EUR'), -- Port Aventura
+    (7, 3, 'child', 5200, 'EUR'),
+    (8, 3, 'season_pass', 19900, 'EUR');
 
 INSERT INTO users (id, name, email, password, access_level, birth_date, city, profile_picture, description)
 VALUES
@@ -133,6 +260,9 @@ VALUES
     (6, 3, 3, 'Mi parque temático favorito de España'), -- Meryl Silverburgh de Port aventura
     (7, 1, 3, 'Ferrari-Land es una pasada'); -- Solid Snake de Port aventura
 
+-- Test users have their emails verified
+UPDATE users SET email_verified = NOW();
+
 -- Synchronize sequences
 -- N.B: We need to do this since we are setting ids manually in the test dataset. If we do not do this,
 -- we would face issues with violation of primary key constraints.
@@ -140,6 +270,9 @@ VALUES
 SELECT setval('attractions_id_seq', (SELECT MAX(id) from attractions));
 SELECT setval('categories_id_seq', (SELECT MAX(id) from categories));
 SELECT setval('comments_id_seq', (SELECT MAX(id) from comments));
+SELECT setval('park_date_hours_id_seq', (SELECT MAX(id) from park_date_hours));
+SELECT setval('park_weekly_hours_id_seq', (SELECT MAX(id) from park_weekly_hours));
+SELECT setval('ticket_prices_id_seq', (SELECT MAX(id) from ticket_prices));
 SELECT setval('themeparks_categories_id_seq', (SELECT MAX(id) from themeparks_categories));
 SELECT setval('themeparks_id_seq', (SELECT MAX(id) from themeparks));
 SELECT setval('tokens_id_seq', (SELECT MAX(id) from tokens));
@@ -0,0 +1,7 @@
+-- Tokens expire after a configurable TTL (THEMEPARK_TOKEN_TTL).
+-- Existing tokens get the default TTL of 24 hours from their creation, so the ones older than that stop working.
+ALTER TABLE tokens ADD COLUMN expires TIMESTAMP WITH TIME ZONE;
+UPDATE tokens SET expires = created + INTERVAL '24 hours';
+ALTER TABLE tokens ALTER COLUMN expires SET NOT NULL;
+
+CREATE INDEX tokens_expires_idx ON tokens (expires);
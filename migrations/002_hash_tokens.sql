@@ -0,0 +1,5 @@
+-- Tokens are stored as the SHA-256 hex digest of the token given to the user.
+-- Hashing the existing plaintext tokens keeps the current sessions working.
+ALTER TABLE tokens RENAME COLUMN token TO token_hash;
+UPDATE tokens SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex');
+ALTER TABLE tokens ADD CONSTRAINT tokens_token_hash_key UNIQUE (token_hash);
@@ -0,0 +1,5 @@
+-- Signed access tokens carry the token version of the user, and are rejected once it is bumped. Logging out
+-- everywhere bumps it and records when, so the servers only have to reload the recently revoked users.
+ALTER TABLE users ADD COLUMN token_version INT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN tokens_revoked TIMESTAMP WITH TIME ZONE;
+CREATE INDEX users_tokens_revoked_idx ON users (tokens_revoked);
@@ -0,0 +1,8 @@
+-- Refresh tokens live in the tokens table too. Every login starts a family of tokens, so reusing a rotated
+-- refresh token can revoke the whole session. Each existing token gets its own family.
+ALTER TABLE tokens ADD COLUMN family UUID NOT NULL DEFAULT gen_random_uuid();
+ALTER TABLE tokens ALTER COLUMN family DROP DEFAULT;
+ALTER TABLE tokens ADD COLUMN refresh BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE tokens ADD COLUMN used TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX tokens_family_idx ON tokens (family);
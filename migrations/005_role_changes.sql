@@ -0,0 +1,10 @@
+-- Registration used to create admins. New users are now normal users (access level 2), and only admins change
+-- roles, recording it here. Existing users registered as admins have to be reviewed by hand.
+CREATE TABLE role_changes (
+    id INT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    user_id INT NOT NULL REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    changed_by INT REFERENCES users (id) ON UPDATE CASCADE ON DELETE SET NULL,
+    old_access_level INT NOT NULL,
+    new_access_level INT NOT NULL,
+    created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
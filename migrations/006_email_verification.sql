@@ -0,0 +1,15 @@
+-- New users can't log in until they confirm their email with the link sent to it.
+-- Existing users keep working, so they are marked as verified.
+ALTER TABLE users ADD COLUMN email_verified TIMESTAMP WITH TIME ZONE;
+UPDATE users SET email_verified = created;
+
+CREATE TABLE user_tokens (
+    id INT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    user_id INT NOT NULL REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    purpose TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires TIMESTAMP WITH TIME ZONE NOT NULL,
+    created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX user_tokens_user_id_idx ON user_tokens (user_id, purpose, created);
@@ -0,0 +1,7 @@
+-- Failed logins are counted per account and per IP, locking them out for a growing time.
+CREATE TABLE login_failures (
+    key TEXT PRIMARY KEY,
+    failures INT NOT NULL,
+    last_failure TIMESTAMP WITH TIME ZONE NOT NULL,
+    locked_until TIMESTAMP WITH TIME ZONE
+);
@@ -0,0 +1,14 @@
+-- Attractions only had a name. Existing ones get type 'other' and status 'open', and unknown restrictions.
+ALTER TABLE attractions
+    ADD COLUMN type TEXT NOT NULL DEFAULT 'other' CHECK (type IN ('coaster', 'water_ride', 'dark_ride', 'flat_ride', 'drop_tower', 'kids_ride', 'show', 'other')),
+    ADD COLUMN status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'closed', 'maintenance', 'seasonal')),
+    ADD COLUMN min_height_cm INT,
+    ADD COLUMN max_height_cm INT,
+    ADD COLUMN min_age INT,
+    ADD COLUMN thrill_level INT CHECK (thrill_level BETWEEN 1 AND 5),
+    ADD COLUMN duration_seconds INT,
+    ADD COLUMN capacity_per_hour INT,
+    ADD COLUMN wheelchair_accessible BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN transfer_required BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN companion_required BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN sensory_friendly BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,13 @@
+-- Wait times reported by the users for the attractions. The app estimates the current wait time from the
+-- recent reports and averages the last weeks by hour and weekday, in the time zone of the park.
+ALTER TABLE themeparks ADD COLUMN time_zone TEXT NOT NULL DEFAULT 'UTC';
+
+CREATE TABLE wait_time_reports (
+    id INT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    attraction_id INT NOT NULL REFERENCES attractions (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    user_id INT REFERENCES users (id) ON UPDATE CASCADE ON DELETE SET NULL,
+    wait_minutes INT NOT NULL CHECK (wait_minutes BETWEEN 0 AND 600),
+    created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX wait_time_reports_attraction_id_idx ON wait_time_reports (attraction_id, created);
@@ -0,0 +1,21 @@
+-- Opening hours of the parks: regular weekly hours, and hours or closures of specific dates replacing them.
+-- Hours are local to the time zone of the park.
+CREATE TABLE park_weekly_hours (
+    id INT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    themepark_id INT NOT NULL REFERENCES themeparks (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    weekday INT NOT NULL CHECK (weekday BETWEEN 0 AND 6), -- 0 is Sunday
+    opens TIME NOT NULL,
+    closes TIME NOT NULL CHECK (closes > opens)
+);
+
+CREATE TABLE park_date_hours (
+    id INT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    themepark_id INT NOT NULL REFERENCES themeparks (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    date DATE NOT NULL,
+    opens TIME, -- NULL if the park is closed that date
+    closes TIME CHECK (closes > opens),
+    note TEXT NOT NULL DEFAULT '',
+    CHECK ((opens IS NULL) = (closes IS NULL))
+);
+
+CREATE INDEX park_date_hours_themepark_id_idx ON park_date_hours (themepark_id, date);
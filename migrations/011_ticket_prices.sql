@@ -0,0 +1,15 @@
+-- Ticket prices of the parks per tier, valid between two dates. NULL dates are open ended, and the app checks
+-- that prices of the same tier of a park don't overlap in time. Amounts are kept in cents, the minor unit of the
+-- currency, as integers like in the API, so they never go through a float.
+CREATE TABLE ticket_prices (
+    id INT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    themepark_id INT NOT NULL REFERENCES themeparks (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    tier TEXT NOT NULL CHECK (tier IN ('adult', 'child', 'senior', 'season_pass')),
+    amount_cents BIGINT NOT NULL CHECK (amount_cents >= 0),
+    currency TEXT NOT NULL CHECK (currency ~ '^[A-Z]{3}$'), -- ISO 4217
+    valid_from DATE,
+    valid_to DATE CHECK (valid_to >= valid_from),
+    created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX ticket_prices_themepark_id_idx ON ticket_prices (themepark_id, tier);
@@ -0,0 +1,4 @@
+-- Emails are stored trimmed and in lower case, so the same address always finds the same user. Fails if two
+-- users only differ in the case of their email: merge or rename them first.
+UPDATE users SET email = lower(trim(email)) WHERE email <> lower(trim(email));
+ALTER TABLE users ADD CONSTRAINT users_email_normalized CHECK (email = lower(trim(email)));
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/evenstarw1/theme-park-data/pkg/themepark"
+)
+
+// Environment variables
+const (
+	envDbConnectionString = "THEMEPARK_DB_CONNECTION_STRING" // Connection string to the PostgreSQL database
+	envListeningPort      = "THEMEPARK_LISTENING_PORT"       // Port where the standalone server listens
+	envShutdownTimeout    = "THEMEPARK_SHUTDOWN_TIMEOUT"     // Time given to in-flight requests on shutdown, e.g. "15s"
+	envQueryTimeout       = "THEMEPARK_QUERY_TIMEOUT"        // Time after which the queries of a request are cancelled, e.g. "5s"
+
+	envTokenTTL             = "THEMEPARK_TOKEN_TTL"              // Time a login token is valid, e.g. "24h"
+	envRefreshTokenTTL      = "THEMEPARK_REFRESH_TOKEN_TTL"      // Time a refresh token is valid, e.g. "720h"
+	envTokenCleanupInterval = "THEMEPARK_TOKEN_CLEANUP_INTERVAL" // How often the standalone server deletes expired tokens, e.g. "1h"
+	envSigningKeys          = "THEMEPARK_SIGNING_KEYS"           // Keys to sign access tokens, see themepark.NewTokenSigner. Unset means opaque tokens
+	envAccessTokenTTL       = "THEMEPARK_ACCESS_TOKEN_TTL"       // Time a signed access token is valid, e.g. "15m"
+	envTokenVersionRefresh  = "THEMEPARK_TOKEN_VERSION_REFRESH"  // How often the standalone server reloads the revoked access tokens, e.g. "30s"
+
+	envPublicURL    = "THEMEPARK_PUBLIC_URL"    // Base URL of the API in the links sent by email, e.g. "https://api.parkfinder.com"
+	envMailFrom     = "THEMEPARK_MAIL_FROM"     // Sender of the emails
+	envSMTPAddr     = "THEMEPARK_SMTP_ADDR"     // SMTP server as host:port. Unset means no SMTP
+	envSMTPUsername = "THEMEPARK_SMTP_USERNAME" // SMTP user, if the server needs authentication
+	envSMTPPassword = "THEMEPARK_SMTP_PASSWORD" // SMTP password
+	envMailDir      = "THEMEPARK_MAIL_DIR"      // Without SMTP, directory where emails are written as .eml files. Unset means they are only logged
+
+	envClientIPHeader = "THEMEPARK_CLIENT_IP_HEADER" // Header with the client IP set by the proxy in front of the app, e.g. "X-Forwarded-For"
+
+	envDbMaxConns          = "THEMEPARK_DB_MAX_CONNS"           // Maximum size of the connection pool
+	envDbMinConns          = "THEMEPARK_DB_MIN_CONNS"           // Minimum size of the connection pool
+	envDbMaxConnLifetime   = "THEMEPARK_DB_MAX_CONN_LIFETIME"   // Time after which a connection is closed, e.g. "1h"
+	envDbHealthCheckPeriod = "THEMEPARK_DB_HEALTH_CHECK_PERIOD" // How often idle connections are checked, e.g. "1m"
+)
+
+// Config holds the settings of the app, read from the environment.
+type Config struct {
+	DatabaseConnectionString string
+	ListeningPort            int
+	ShutdownTimeout          time.Duration
+	QueryTimeout             time.Duration
+	TokenTTL                 time.Duration
+	RefreshTokenTTL          time.Duration
+	TokenCleanupInterval     time.Duration
+	SigningKeys              string
+	AccessTokenTTL           time.Duration
+	TokenVersionRefresh      time.Duration
+	DatabasePool             themepark.PoolConfig
+	PublicURL                string
+	MailFrom                 string
+	SMTPAddr                 string
+	SMTPUsername             string
+	SMTPPassword             string
+	MailDir                  string
+	ClientIPHeader           string
+}
+
+// FromEnv reads the environment variables, using default values for the ones not set.
+func FromEnv() Config {
+	var config Config
+
+	config.DatabaseConnectionString = os.Getenv(envDbConnectionString)
+	if config.DatabaseConnectionString == "" {
+		config.DatabaseConnectionString = "postgres://localhost:5432/themepark"
+	}
+
+	config.ListeningPort = intFromEnv(envListeningPort, 8080)
+	config.ShutdownTimeout = durationFromEnv(envShutdownTimeout, 15*time.Second)
+	config.QueryTimeout = durationFromEnv(envQueryTimeout, 10*time.Second)
+	config.TokenTTL = durationFromEnv(envTokenTTL, themepark.DefaultTokenTTL)
+	config.RefreshTokenTTL = durationFromEnv(envRefreshTokenTTL, themepark.DefaultRefreshTokenTTL)
+	config.TokenCleanupInterval = durationFromEnv(envTokenCleanupInterval, time.Hour)
+	config.SigningKeys = os.Getenv(envSigningKeys)
+	config.AccessTokenTTL = durationFromEnv(envAccessTokenTTL, themepark.DefaultAccessTokenTTL)
+	config.TokenVersionRefresh = durationFromEnv(envTokenVersionRefresh, 30*time.Second)
+
+	config.PublicURL = os.Getenv(envPublicURL)
+	config.MailFrom = os.Getenv(envMailFrom)
+	if config.MailFrom == "" {
+		config.MailFrom = "no-reply@parkfinder.com"
+	}
+	config.SMTPAddr = os.Getenv(envSMTPAddr)
+	config.SMTPUsername = os.Getenv(envSMTPUsername)
+	config.SMTPPassword = os.Getenv(envSMTPPassword)
+	config.MailDir = os.Getenv(envMailDir)
+	config.ClientIPHeader = os.Getenv(envClientIPHeader)
+
+	// Zero values keep the pgxpool defaults
+	config.DatabasePool = themepark.PoolConfig{
+		MaxConns:          int32(intFromEnv(envDbMaxConns, 0)),
+		MinConns:          int32(intFromEnv(envDbMinConns, 0)),
+		MaxConnLifetime:   durationFromEnv(envDbMaxConnLifetime, 0),
+		HealthCheckPeriod: durationFromEnv(envDbHealthCheckPeriod, 0),
+	}
+
+	return config
+}
+
+// RouterOptions returns the options of themepark.NewRouter for this config, failing if the signing keys are invalid.
+func (c Config) RouterOptions() ([]themepark.RouterOption, error) {
+	opts := []themepark.RouterOption{
+		themepark.WithQueryTimeout(c.QueryTimeout),
+		themepark.WithTokenTTL(c.TokenTTL),
+		themepark.WithRefreshTokenTTL(c.RefreshTokenTTL),
+		themepark.WithPublicURL(c.PublicURL),
+		themepark.WithClientIPHeader(c.ClientIPHeader),
+	}
+
+	switch {
+	case c.SMTPAddr != "":
+		opts = append(opts, themepark.WithMailer(&themepark.SMTPMailer{
+			Addr:     c.SMTPAddr,
+			From:     c.MailFrom,
+			Username: c.SMTPUsername,
+			Password: c.SMTPPassword,
+		}))
+	case c.MailDir != "":
+		opts = append(opts, themepark.WithMailer(&themepark.FileMailer{Dir: c.MailDir, From: c.MailFrom}))
+	}
+
+	if c.SigningKeys != "" {
+		signer, err := themepark.NewTokenSigner(c.SigningKeys)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, themepark.WithTokenSigner(signer), themepark.WithAccessTokenTTL(c.AccessTokenTTL))
+	}
+
+	return opts, nil
+}
+
+// intFromEnv returns the integer value of an environment variable, or def if it is not set or invalid.
+func intFromEnv(name string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+
+	return value
+}
+
+// durationFromEnv returns the duration value of an environment variable, or def if it is not set or invalid.
+func durationFromEnv(name string, def time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+
+	return value
+}
@@ -0,0 +1,205 @@
+package themepark
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signed access tokens are JWTs (RFC 7519) carrying the user id, access level and token version, so AuthMiddleware
+// can check them without going to the database; revoked versions come from TokenVersions, refreshed in the background.
+// They are signed with HS256 or EdDSA (Ed25519), and the "kid" header says which key signed them, so keys can be
+// rotated while the tokens of the old key are still valid.
+const (
+	algHS256 = "HS256"
+	algEdDSA = "EdDSA"
+)
+
+// DefaultAccessTokenTTL is how long signed access tokens are valid, unless changed with WithAccessTokenTTL
+const DefaultAccessTokenTTL = 15 * time.Minute
+
+var errInvalidAccessToken = fmt.Errorf("%w: invalid access token", ErrUnauthorized)
+
+// accessClaims are the claims of a signed access token
+type accessClaims struct {
+	Subject     string `json:"sub"` // User id
+	AccessLevel int    `json:"lvl"`
+	Version     int    `json:"ver"` // Token version of the user, see Store.GetTokenVersion
+	IssuedAt    int64  `json:"iat"`
+	ExpiresAt   int64  `json:"exp"`
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+type signingKey struct {
+	alg        string
+	secret     []byte             // HS256
+	privateKey ed25519.PrivateKey // EdDSA, nil for verify only keys
+	publicKey  ed25519.PublicKey  // EdDSA
+}
+
+// TokenSigner signs and verifies access tokens. The first key signs new tokens, the rest only verify.
+type TokenSigner struct {
+	kid  string
+	keys map[string]signingKey
+}
+
+// NewTokenSigner parses a comma separated list of keys in the form kid:type:base64 key, where type is one of
+//   - hs256: HMAC secret of at least 32 bytes
+//   - ed25519: Ed25519 private key seed (32 bytes)
+//   - ed25519-public: Ed25519 public key (32 bytes), only to verify tokens of a retired key
+//
+// The first key signs new tokens, so it can't be a public key. To rotate, prepend the new key and keep the
+// old one until its tokens have expired.
+func NewTokenSigner(keys string) (*TokenSigner, error) {
+	signer := &TokenSigner{keys: map[string]signingKey{}}
+
+	for i, spec := range strings.Split(keys, ",") {
+		parts := strings.Split(strings.TrimSpace(spec), ":")
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("signing key %d: expected kid:type:base64 key", i+1)
+		}
+		kid, keyType := parts[0], parts[1]
+
+		raw, err := base64.StdEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("signing key %s: %w", kid, err)
+		}
+
+		var key signingKey
+		switch keyType {
+		case "hs256":
+			if len(raw) < 32 {
+				return nil, fmt.Errorf("signing key %s: HMAC secret must have at least 32 bytes", kid)
+			}
+			key = signingKey{alg: algHS256, secret: raw}
+		case "ed25519":
+			if len(raw) != ed25519.SeedSize {
+				return nil, fmt.Errorf("signing key %s: Ed25519 seed must have %d bytes", kid, ed25519.SeedSize)
+			}
+			privateKey := ed25519.NewKeyFromSeed(raw)
+			key = signingKey{alg: algEdDSA, privateKey: privateKey, publicKey: privateKey.Public().(ed25519.PublicKey)}
+		case "ed25519-public":
+			if len(raw) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("signing key %s: Ed25519 public key must have %d bytes", kid, ed25519.PublicKeySize)
+			}
+			if i == 0 {
+				return nil, fmt.Errorf("signing key %s: the first key signs tokens, it can't be a public key", kid)
+			}
+			key = signingKey{alg: algEdDSA, publicKey: raw}
+		default:
+			return nil, fmt.Errorf("signing key %s: unknown type %q", kid, keyType)
+		}
+
+		if _, ok := signer.keys[kid]; ok {
+			return nil, fmt.Errorf("signing key %s: duplicated kid", kid)
+		}
+		signer.keys[kid] = key
+		if i == 0 {
+			signer.kid = kid
+		}
+	}
+
+	return signer, nil
+}
+
+// Sign returns an access token for the user with its current token version, valid for ttl
+func (s *TokenSigner) Sign(userID int, accessLevel int, version int, ttl time.Duration) (string, error) {
+	key := s.keys[s.kid]
+	now := time.Now()
+
+	header, err := json.Marshal(jwtHeader{Alg: key.alg, Typ: "JWT", Kid: s.kid})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(accessClaims{
+		Subject:     strconv.Itoa(userID),
+		AccessLevel: accessLevel,
+		Version:     version,
+		IssuedAt:    now.Unix(),
+		ExpiresAt:   now.Add(ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(key.sign([]byte(signingInput))), nil
+}
+
+// Verify checks the signature and expiry of an access token, returning its user id, access level and token version
+func (s *TokenSigner) Verify(token string) (int, int, int, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, 0, 0, errInvalidAccessToken
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return 0, 0, 0, errInvalidAccessToken
+	}
+
+	// The algorithm comes from the key, never from the token, so a token can't pick a weaker one
+	key, ok := s.keys[header.Kid]
+	if !ok || header.Alg != key.alg {
+		return 0, 0, 0, errInvalidAccessToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return 0, 0, 0, errInvalidAccessToken
+	}
+
+	var claims accessClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return 0, 0, 0, errInvalidAccessToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return 0, 0, 0, fmt.Errorf("%w: access token expired", ErrUnauthorized)
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return 0, 0, 0, errInvalidAccessToken
+	}
+
+	return userID, claims.AccessLevel, claims.Version, nil
+}
+
+func (k signingKey) sign(message []byte) []byte {
+	if k.alg == algEdDSA {
+		return ed25519.Sign(k.privateKey, message)
+	}
+
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+func (k signingKey) verify(message, signature []byte) bool {
+	if k.alg == algEdDSA {
+		return ed25519.Verify(k.publicKey, message, signature)
+	}
+
+	return hmac.Equal(k.sign(message), signature)
+}
+
+// decodeSegment decodes a base64url JSON segment of a token into v
+func decodeSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,115 @@
+package themepark
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Matches returns whether the attraction passes the filter. Both stores filter with it, so they agree.
+func (f AttractionFilter) Matches(attraction Attraction) bool {
+	if len(f.Types) > 0 && !slices.Contains(f.Types, attraction.Type) {
+		return false
+	}
+	if len(f.Statuses) > 0 && !slices.Contains(f.Statuses, attraction.Status) {
+		return false
+	}
+	if f.Height > 0 {
+		if attraction.MinHeight != nil && f.Height < *attraction.MinHeight {
+			return false
+		}
+		if attraction.MaxHeight != nil && f.Height > *attraction.MaxHeight {
+			return false
+		}
+	}
+	if f.Age > 0 && attraction.MinAge != nil && f.Age < *attraction.MinAge {
+		return false
+	}
+	if f.MaxThrillLevel > 0 && (attraction.ThrillLevel == nil || *attraction.ThrillLevel > f.MaxThrillLevel) {
+		return false
+	}
+	if f.WheelchairAccessible && !attraction.Accessibility.WheelchairAccessible {
+		return false
+	}
+	if f.SensoryFriendly && !attraction.Accessibility.SensoryFriendly {
+		return false
+	}
+
+	return true
+}
+
+// filterAttractions returns the attractions that pass the filter
+func filterAttractions(attractions []Attraction, filter AttractionFilter) []Attraction {
+	var filtered []Attraction
+	for _, attraction := range attractions {
+		if filter.Matches(attraction) {
+			filtered = append(filtered, attraction)
+		}
+	}
+
+	return filtered
+}
+
+// parseAttractionFilter reads an AttractionFilter from the query parameters type, status (both comma separated
+// lists), height, age, max_thrill, wheelchair_accessible and sensory_friendly
+func parseAttractionFilter(query url.Values) (AttractionFilter, error) {
+	var filter AttractionFilter
+	var v validator
+
+	filter.Types = queryList(query, "type")
+	for _, attractionType := range filter.Types {
+		v.check(slices.Contains(AttractionTypes, attractionType), "type", fmt.Sprintf("unknown attraction type %q", attractionType))
+	}
+	filter.Statuses = queryList(query, "status")
+	for _, status := range filter.Statuses {
+		v.check(slices.Contains(AttractionStatuses, status), "status", fmt.Sprintf("unknown attraction status %q", status))
+	}
+
+	filter.Height = queryInt(&v, query, "height")
+	filter.Age = queryInt(&v, query, "age")
+	filter.MaxThrillLevel = queryInt(&v, query, "max_thrill")
+	filter.WheelchairAccessible = queryBool(&v, query, "wheelchair_accessible")
+	filter.SensoryFriendly = queryBool(&v, query, "sensory_friendly")
+
+	return filter, v.err()
+}
+
+// queryList returns the comma separated values of a query parameter, which can also be repeated
+func queryList(query url.Values, name string) []string {
+	var values []string
+	for _, value := range query[name] {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+
+	return values
+}
+
+// queryInt returns a positive integer query parameter, or 0 if it isn't set
+func queryInt(v *validator, query url.Values, name string) int {
+	if !query.Has(name) {
+		return 0
+	}
+
+	n, err := strconv.Atoi(query.Get(name))
+	v.check(err == nil && n > 0, name, "must be a positive integer")
+
+	return max(n, 0)
+}
+
+// queryBool returns a boolean query parameter, or false if it isn't set
+func queryBool(v *validator, query url.Values, name string) bool {
+	if !query.Has(name) {
+		return false
+	}
+
+	b, err := strconv.ParseBool(query.Get(name))
+	v.check(err == nil, name, "must be true or false")
+
+	return b
+}
@@ -0,0 +1,43 @@
+package themepark
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// AuthUser is the identity of the caller of a private route, set by AuthMiddleware
+type AuthUser struct {
+	ID          int
+	AccessLevel int
+}
+
+type authUserKey struct{}
+
+// UserFromContext returns the user authenticated by AuthMiddleware, or false if the request has none.
+func UserFromContext(ctx context.Context) (AuthUser, bool) {
+	user, ok := ctx.Value(authUserKey{}).(AuthUser)
+	return user, ok
+}
+
+// contextWithUser returns a copy of ctx carrying the authenticated user
+func contextWithUser(ctx context.Context, user AuthUser) context.Context {
+	return context.WithValue(ctx, authUserKey{}, user)
+}
+
+// identityHeaderPrefix is the prefix of the headers older versions used to pass the identity to the handlers.
+// Clients could send them too, so they are removed from every request.
+const identityHeaderPrefix = "App-User-"
+
+// stripIdentityHeaders removes the app-user-* headers sent by the client
+func stripIdentityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name := range r.Header {
+			if strings.HasPrefix(http.CanonicalHeaderKey(name), identityHeaderPrefix) {
+				r.Header.Del(name)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
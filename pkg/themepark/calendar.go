@@ -0,0 +1,192 @@
+package themepark
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+	_ "time/tzdata" // Parks can be in any time zone, even on systems without the zoneinfo files
+)
+
+const (
+	dateLayout      = "2006-01-02"
+	maxScheduleDays = 366 // Longest date range of a schedule
+	scheduleDays    = 7   // Default date range of a schedule
+	icsDays         = 90  // Default date range of the iCalendar export
+	nextOpeningDays = 28  // How far OpenAt looks for the next opening of a closed park
+)
+
+var errInvalidClock = errors.New("must be a time as HH:MM")
+
+// openingInterval is an opening of a park between two instants
+type openingInterval struct {
+	start time.Time
+	end   time.Time
+}
+
+// parseClock parses a "HH:MM" time into minutes since midnight. "24:00" is the end of the day.
+func parseClock(clock string) (int, error) {
+	if clock == "24:00" {
+		return 24 * 60, nil
+	}
+
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, errInvalidClock
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// formatClock formats minutes since midnight as "HH:MM"
+func formatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// parseWeekday parses a weekday as used in the API, returning false if it isn't one
+func parseWeekday(name string) (time.Weekday, bool) {
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		if weekdayName(weekday) == name {
+			return weekday, true
+		}
+	}
+
+	return 0, false
+}
+
+// location returns the time zone of the park. Calendars are validated before being stored, so it is only UTC
+// for parks without a calendar.
+func (c ParkCalendar) location() *time.Location {
+	return parkLocation(c.TimeZone)
+}
+
+// Day returns the schedule of a date: its exceptions if it has any, otherwise the weekly hours of its weekday
+func (c ParkCalendar) Day(date time.Time) DaySchedule {
+	schedule := DaySchedule{Date: date.Format(dateLayout)}
+
+	exceptional := false
+	for _, exception := range c.Exceptions {
+		if exception.Date != schedule.Date {
+			continue
+		}
+		exceptional = true
+		if exception.Note != "" {
+			schedule.Note = exception.Note
+		}
+		if !exception.Closed {
+			schedule.Hours = append(schedule.Hours, OpeningHours{Opens: exception.Opens, Closes: exception.Closes})
+		}
+	}
+
+	if !exceptional {
+		weekday := weekdayName(date.Weekday())
+		for _, hours := range c.Weekly {
+			if hours.Weekday == weekday {
+				schedule.Hours = append(schedule.Hours, OpeningHours{Opens: hours.Opens, Closes: hours.Closes})
+			}
+		}
+	}
+
+	// "HH:MM" sorts as text
+	sort.Slice(schedule.Hours, func(i, j int) bool { return schedule.Hours[i].Opens < schedule.Hours[j].Opens })
+	schedule.Closed = len(schedule.Hours) == 0
+
+	return schedule
+}
+
+// Schedule returns the schedule of every date from from to to, both included
+func (c ParkCalendar) Schedule(from time.Time, to time.Time) []DaySchedule {
+	var days []DaySchedule
+	for date := from; !date.After(to); date = date.AddDate(0, 0, 1) {
+		days = append(days, c.Day(date))
+	}
+
+	return days
+}
+
+// OpenAt says whether the park is open at the instant, with when it closes or else when it opens next
+func (c ParkCalendar) OpenAt(at time.Time) OpenStatus {
+	location := c.location()
+	local := at.In(location)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+	status := OpenStatus{At: local}
+
+	// Opening hours end at midnight at the latest, so only the ones of today can include the instant
+	for _, opening := range c.openings(c.Day(today), location) {
+		if !at.Before(opening.start) && at.Before(opening.end) {
+			status.Open = true
+			status.Closes = &opening.end
+			return status
+		}
+	}
+
+	for i := 0; i < nextOpeningDays; i++ {
+		for _, opening := range c.openings(c.Day(today.AddDate(0, 0, i)), location) {
+			if opening.start.After(at) {
+				status.NextOpening = &opening.start
+				return status
+			}
+		}
+	}
+
+	return status
+}
+
+// openings returns the instants a park opens and closes on a day
+func (c ParkCalendar) openings(day DaySchedule, location *time.Location) []openingInterval {
+	date, err := time.ParseInLocation(dateLayout, day.Date, location)
+	if err != nil {
+		return nil
+	}
+
+	var openings []openingInterval
+	for _, hours := range day.Hours {
+		opens, err := parseClock(hours.Opens)
+		if err != nil {
+			continue
+		}
+		closes, err := parseClock(hours.Closes)
+		if err != nil {
+			continue
+		}
+
+		// time.Date takes care of the daylight saving changes and of "24:00" being the next day
+		openings = append(openings, openingInterval{
+			start: time.Date(date.Year(), date.Month(), date.Day(), opens/60, opens%60, 0, 0, location),
+			end:   time.Date(date.Year(), date.Month(), date.Day(), closes/60, closes%60, 0, 0, location),
+		})
+	}
+
+	return openings
+}
+
+// parseDateRange reads the from and to query parameters, both included, as dates in the time zone of the park.
+// From defaults to today and to to defaultDays days of schedule.
+func parseDateRange(query url.Values, location *time.Location, defaultDays int) (time.Time, time.Time, error) {
+	var v validator
+
+	now := time.Now().In(location)
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+	if query.Has("from") {
+		date, err := time.ParseInLocation(dateLayout, query.Get("from"), location)
+		v.check(err == nil, "from", "must be a date as YYYY-MM-DD")
+		if err == nil {
+			from = date
+		}
+	}
+
+	to := from.AddDate(0, 0, defaultDays-1)
+	if query.Has("to") {
+		date, err := time.ParseInLocation(dateLayout, query.Get("to"), location)
+		v.check(err == nil, "to", "must be a date as YYYY-MM-DD")
+		if err == nil {
+			to = date
+		}
+	}
+
+	v.check(!to.Before(from), "to", "must not be before from")
+	v.check(!to.After(from.AddDate(0, 0, maxScheduleDays-1)), "to", fmt.Sprintf("must be at most %d days after from", maxScheduleDays-1))
+
+	return from, to, v.err()
+}
@@ -0,0 +1,98 @@
+package themepark
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenAtAcrossDaylightSaving(t *testing.T) {
+	// In Europe/Madrid daylight saving time starts on 2024-03-31 and ends on 2024-10-27
+	calendar := ParkCalendar{
+		TimeZone: "Europe/Madrid",
+		Weekly: []WeeklyHours{
+			{Weekday: "saturday", Opens: "10:00", Closes: "24:00"},
+			{Weekday: "sunday", Opens: "10:00", Closes: "20:00"},
+		},
+	}
+
+	instant := func(value string) time.Time {
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return at
+	}
+
+	tests := []struct {
+		name        string
+		at          string
+		open        bool
+		closes      string
+		nextOpening string
+	}{
+		{"before the spring change", "2024-03-30T23:30:00Z", false, "", "2024-03-31T08:00:00Z"},
+		{"after the spring change", "2024-03-31T08:30:00Z", true, "2024-03-31T18:00:00Z", ""},
+		{"closing at midnight before the autumn change", "2024-10-26T21:30:00Z", true, "2024-10-26T22:00:00Z", ""},
+		{"before opening after the autumn change", "2024-10-27T08:30:00Z", false, "", "2024-10-27T09:00:00Z"},
+		{"after the autumn change", "2024-10-27T09:30:00Z", true, "2024-10-27T19:00:00Z", ""},
+		{"closed until next weekend", "2024-10-27T19:00:00Z", false, "", "2024-11-02T09:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := calendar.OpenAt(instant(tt.at))
+
+			if status.Open != tt.open {
+				t.Errorf("open = %v, want %v", status.Open, tt.open)
+			}
+			if status.At.Location().String() != "Europe/Madrid" {
+				t.Errorf("at is in %s, want the time zone of the park", status.At.Location())
+			}
+			checkInstant(t, "closes", status.Closes, tt.closes)
+			checkInstant(t, "next opening", status.NextOpening, tt.nextOpening)
+		})
+	}
+}
+
+// checkInstant checks an optional instant against an RFC 3339 value, empty if it must be nil
+func checkInstant(t *testing.T, name string, got *time.Time, want string) {
+	t.Helper()
+
+	switch {
+	case got == nil && want != "":
+		t.Errorf("%s = nil, want %s", name, want)
+	case got != nil && want == "":
+		t.Errorf("%s = %s, want nil", name, got.UTC().Format(time.RFC3339))
+	case got != nil && got.UTC().Format(time.RFC3339) != want:
+		t.Errorf("%s = %s, want %s", name, got.UTC().Format(time.RFC3339), want)
+	}
+}
+
+func TestParkICSAcrossDaylightSaving(t *testing.T) {
+	s := newTestServer(t)
+	user := s.login("revolver.occelote@konami.jp", "ocelote1234").AccessToken
+
+	// Port Aventura, in Europe/Madrid, opens from 10:00 to 24:00 on Saturdays and to 20:00 on Sundays
+	rec := s.do(http.MethodGet, "/priv/park/3/calendar.ics?from=2024-10-26&to=2024-10-27", user, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/calendar; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(rec.Body.String(), "\r\n") {
+		if strings.HasPrefix(line, "DTSTART") || strings.HasPrefix(line, "DTEND") {
+			lines = append(lines, line)
+		}
+	}
+	want := []string{
+		"DTSTART:20241026T080000Z", "DTEND:20241026T220000Z", // UTC+2
+		"DTSTART:20241027T090000Z", "DTEND:20241027T190000Z", // UTC+1
+	}
+	if strings.Join(lines, " ") != strings.Join(want, " ") {
+		t.Errorf("events = %v, want %v", lines, want)
+	}
+}
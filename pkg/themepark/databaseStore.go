@@ -2,485 +2,1772 @@ package themepark
 
 import (
 	"context"
-	"crypto/sha256"
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"os"
+	"time"
 )
 
+// PostgreSQL error codes mapped to the errors of the package
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pgForeignKeyViolation = "23503"
+	pgUniqueViolation     = "23505"
+)
+
+// constraintFields maps the constraints of database.sql to the payload fields they check
+var constraintFields = map[string]string{
+	"unique_email":                           "email",
+	"unique_name":                            "name",
+	"users_categories_category_id_fkey":      "categories",
+	"themeparks_categories_category_id_fkey": "categories",
+	"comments_themepark_id_fkey":             "themepark_id",
+	"comments_user_id_fkey":                  "user_id",
+}
+
+// PoolConfig configures the connection pool of a DatabaseStore. Zero values keep the pgxpool defaults.
+type PoolConfig struct {
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	HealthCheckPeriod time.Duration
+}
+
+// PoolStats is a snapshot of the connection pool of a DatabaseStore.
+type PoolStats struct {
+	TotalConns           int32         `json:"total_conns"`
+	AcquiredConns        int32         `json:"acquired_conns"`
+	IdleConns            int32         `json:"idle_conns"`
+	ConstructingConns    int32         `json:"constructing_conns"`
+	MaxConns             int32         `json:"max_conns"`
+	AcquireCount         int64         `json:"acquire_count"`
+	EmptyAcquireCount    int64         `json:"empty_acquire_count"`
+	CanceledAcquireCount int64         `json:"canceled_acquire_count"`
+	AcquireDuration      time.Duration `json:"acquire_duration"`
+}
+
+// DatabaseStore implements Store on top of a PostgreSQL connection pool, so it is safe for concurrent use.
 type DatabaseStore struct {
-	conn *pgx.Conn
+	pool *pgxpool.Pool
+}
+
+func NewDatabaseStore(connectString string, poolConfig PoolConfig) (*DatabaseStore, error) {
+	config, err := pgxpool.ParseConfig(connectString)
+	if err != nil {
+		return nil, err
+	}
+
+	if poolConfig.MaxConns > 0 {
+		config.MaxConns = poolConfig.MaxConns
+	}
+	if poolConfig.MinConns > 0 {
+		config.MinConns = poolConfig.MinConns
+	}
+	if poolConfig.MaxConnLifetime > 0 {
+		config.MaxConnLifetime = poolConfig.MaxConnLifetime
+	}
+	if poolConfig.HealthCheckPeriod > 0 {
+		config.HealthCheckPeriod = poolConfig.HealthCheckPeriod
+	}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to create connection pool: %v\n", err)
+		return nil, err
+	}
+
+	// The pool connects lazily, so check the database is reachable before serving requests
+	err = pool.Ping(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to connect to database: %v\n", err)
+		pool.Close()
+		return nil, err
+	}
+
+	return &DatabaseStore{pool: pool}, nil
+}
+
+func (d *DatabaseStore) Close() {
+	d.pool.Close()
+}
+
+// Stats returns the current statistics of the connection pool.
+func (d *DatabaseStore) Stats() PoolStats {
+	stat := d.pool.Stat()
+
+	return PoolStats{
+		TotalConns:           stat.TotalConns(),
+		AcquiredConns:        stat.AcquiredConns(),
+		IdleConns:            stat.IdleConns(),
+		ConstructingConns:    stat.ConstructingConns(),
+		MaxConns:             stat.MaxConns(),
+		AcquireCount:         stat.AcquireCount(),
+		EmptyAcquireCount:    stat.EmptyAcquireCount(),
+		CanceledAcquireCount: stat.CanceledAcquireCount(),
+		AcquireDuration:      stat.AcquireDuration(),
+	}
+}
+
+// mapError translates the errors of pgx into the errors of the package, so handlers can pick the right status.
+func mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		field, ok := constraintFields[pgErr.ConstraintName]
+		if !ok {
+			field = pgErr.ConstraintName
+		}
+
+		switch pgErr.Code {
+		case pgUniqueViolation:
+			return fmt.Errorf("%s %w", field, ErrConflict)
+		case pgForeignKeyViolation:
+			return &ValidationError{Field: field, Message: "references a row that does not exist"}
+		}
+	}
+
+	return err
+}
+
+// getUserCategories returns the category ids of a user.
+func (d *DatabaseStore) getUserCategories(ctx context.Context, userID int) ([]int, error) {
+	var userCategories []int
+	rows, err := d.pool.Query(ctx,
+		"select * from users_categories where user_id = $1", userID)
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		userCategory := UsersCategory{}
+		err := rows.Scan(&userCategory.Id, &userCategory.UserId, &userCategory.CategoryId, &userCategory.Created)
+		if err != nil {
+			return nil, mapError(err)
+		}
+
+		userCategories = append(userCategories, userCategory.CategoryId)
+	}
+
+	return userCategories, mapError(rows.Err())
+}
+
+// getThemeParkCategories returns the categories of a theme park.
+func (d *DatabaseStore) getThemeParkCategories(ctx context.Context, parkID int) ([]Category, error) {
+	var categories []Category
+	rows, err := d.pool.Query(ctx,
+		"select c.id, c.name, c.created from themeparks_categories tc inner join categories c on tc.category_id = c.id where tc.themepark_id = $1", parkID)
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		category := Category{}
+		err := rows.Scan(&category.Id, &category.Name, &category.Created)
+		if err != nil {
+			return nil, mapError(err)
+		}
+
+		categories = append(categories, category)
+	}
+
+	return categories, mapError(rows.Err())
+}
+
+func (d *DatabaseStore) GetUser(ctx context.Context, userID int) (*User, error) {
+	var user User
+	err := d.pool.QueryRow(ctx,
+		"select id, name, email, password, access_level, email_verified is not null, birth_date, city, profile_picture, description from users where id = $1", userID).
+		Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.AccessLevel, &user.EmailVerified, &user.BirthDate, &user.City, &user.ProfilePicture, &user.Description)
+	if err != nil {
+		return nil, fmt.Errorf("user %d: %w", userID, mapError(err))
+	}
+
+	// Get categories for user
+	user.Categories, err = d.getUserCategories(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (d *DatabaseStore) UpdateUser(ctx context.Context, user User) error {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Update user
+	tag, err := tx.Exec(ctx,
+		"update users set name = $1, birth_date = $2, city = $3, profile_picture = $4, description = $5 where id = $6",
+		user.Name, user.BirthDate, user.City, user.ProfilePicture, user.Description, user.ID)
+	if err != nil {
+		return mapError(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user %d: %w", user.ID, ErrNotFound)
+	}
+
+	// Update categories
+	_, err = tx.Exec(ctx,
+		"delete from users_categories where user_id = $1", user.ID)
+	if err != nil {
+		return mapError(err)
+	}
+
+	for _, category := range user.Categories {
+		_, err = tx.Exec(ctx,
+			`insert into users_categories (user_id, category_id) values ($1,$2)`, user.ID, category)
+		if err != nil {
+			return mapError(err)
+		}
+	}
+
+	return mapError(tx.Commit(ctx))
+}
+
+func (d *DatabaseStore) SetUserAccessLevel(ctx context.Context, userID int, accessLevel int, changedBy int) error {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	var oldAccessLevel int
+	err = tx.QueryRow(ctx,
+		"select access_level from users where id = $1 for update", userID).
+		Scan(&oldAccessLevel)
+	if err != nil {
+		return fmt.Errorf("user %d: %w", userID, mapError(err))
+	}
+
+	_, err = tx.Exec(ctx,
+		"update users set access_level = $1 where id = $2", accessLevel, userID)
+	if err != nil {
+		return mapError(err)
+	}
+
+	// The signed access tokens carry the old access level
+	err = revokeTokens(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		"insert into role_changes (user_id, changed_by, old_access_level, new_access_level) values ($1,$2,$3,$4)",
+		userID, changedBy, oldAccessLevel, accessLevel)
+	if err != nil {
+		return mapError(err)
+	}
+
+	return mapError(tx.Commit(ctx))
+}
+
+func (d *DatabaseStore) GetRoleChanges(ctx context.Context, userID int) ([]RoleChange, error) {
+	roleChanges := []RoleChange{}
+
+	rows, err := d.pool.Query(ctx,
+		"select id, user_id, changed_by, old_access_level, new_access_level, created from role_changes where user_id = $1 order by created",
+		userID)
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var roleChange RoleChange
+		err = rows.Scan(&roleChange.Id, &roleChange.UserId, &roleChange.ChangedBy, &roleChange.OldAccessLevel, &roleChange.NewAccessLevel, &roleChange.Created)
+		if err != nil {
+			return nil, mapError(err)
+		}
+		roleChanges = append(roleChanges, roleChange)
+	}
+
+	return roleChanges, mapError(rows.Err())
+}
+
+func (d *DatabaseStore) GetAllUsers(ctx context.Context) ([]User, error) {
+	var users []User
+
+	rows, err := d.pool.Query(ctx,
+		"select id, name, email, access_level, email_verified is not null, birth_date, city, profile_picture, description from users")
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	for rows.Next() {
+		user := User{}
+		err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.AccessLevel, &user.EmailVerified, &user.BirthDate, &user.City, &user.ProfilePicture, &user.Description)
+		if err != nil {
+			rows.Close()
+			return nil, mapError(err)
+		}
+
+		users = append(users, user)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
+	}
+
+	for i, user := range users {
+		// Get categories for user
+		users[i].Categories, err = d.getUserCategories(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return users, nil
+}
+
+func (d *DatabaseStore) GetUserFromEmail(ctx context.Context, email string) (*User, error) {
+	var user User
+	err := d.pool.QueryRow(ctx,
+		"select id, name, email, password, access_level, email_verified is not null, birth_date, city, profile_picture, description from users where email = $1", normalizeEmail(email)).
+		Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.AccessLevel, &user.EmailVerified, &user.BirthDate, &user.City, &user.ProfilePicture, &user.Description)
+	if err != nil {
+		return nil, fmt.Errorf("user %s: %w", email, mapError(err))
+	}
+
+	return &user, nil
+}
+
+func (d *DatabaseStore) SignIn(ctx context.Context, userEmail string, userPass string, ttl SessionTTL) (Session, error) {
+	var user User
+	err := d.pool.QueryRow(ctx,
+		"select id, email, password, email_verified is not null from users where email = $1", normalizeEmail(userEmail)).
+		Scan(&user.ID, &user.Email, &user.Password, &user.EmailVerified)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		checkPassword(userPass, dummyHash())
+		return Session{}, fmt.Errorf("%w: invalid email or password", ErrUnauthorized)
+	}
+	if err != nil {
+		return Session{}, mapError(err)
+	}
+
+	// Check if password matches
+	match, rehash, err := checkPassword(userPass, user.Password)
+	if err != nil {
+		return Session{}, fmt.Errorf("user %s: %w", userEmail, err)
+	}
+
+	if !match {
+		return Session{}, fmt.Errorf("%w: invalid email or password", ErrUnauthorized)
+	}
+
+	if !user.EmailVerified {
+		return Session{}, fmt.Errorf("%w: email %s not verified", ErrForbidden, userEmail)
+	}
+
+	// Upgrade legacy SHA-256 hashes now that we know the password. A failure here must not block the login.
+	if rehash {
+		hashedPass, err := hashPassword(userPass)
+		if err == nil {
+			_, err = d.pool.Exec(ctx,
+				"update users set password = $1 where id = $2 and password = $3", hashedPass, user.ID, user.Password)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to rehash password of user %d: %v\n", user.ID, err)
+		}
+	}
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return Session{}, mapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	session, err := insertSession(ctx, tx, user.ID, uuid.NewString(), ttl)
+	if err != nil {
+		return Session{}, err
+	}
+
+	return session, mapError(tx.Commit(ctx))
+}
+
+func (d *DatabaseStore) RefreshSession(ctx context.Context, refreshToken string, ttl SessionTTL) (Session, error) {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return Session{}, mapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the row, so two refreshes with the same token can't both rotate it
+	var userID int
+	var family string
+	var used pgtype.Timestamptz
+	err = tx.QueryRow(ctx,
+		"select user_id, family::text, used from tokens where token_hash = $1 and refresh and expires > now() for update",
+		hashToken(refreshToken)).
+		Scan(&userID, &family, &used)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Session{}, fmt.Errorf("%w: invalid refresh token", ErrUnauthorized)
+	}
+	if err != nil {
+		return Session{}, mapError(err)
+	}
+
+	if used.Valid {
+		_, err = tx.Exec(ctx,
+			"delete from tokens where family = $1", family)
+		if err != nil {
+			return Session{}, mapError(err)
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return Session{}, mapError(err)
+		}
+
+		return Session{}, fmt.Errorf("%w: refresh token reused, session revoked", ErrUnauthorized)
+	}
+
+	_, err = tx.Exec(ctx,
+		"update tokens set used = now() where token_hash = $1", hashToken(refreshToken))
+	if err != nil {
+		return Session{}, mapError(err)
+	}
+
+	session, err := insertSession(ctx, tx, userID, family, ttl)
+	if err != nil {
+		return Session{}, err
+	}
+
+	return session, mapError(tx.Commit(ctx))
+}
+
+// insertSession stores new tokens for the user in the given family, inside the transaction
+func insertSession(ctx context.Context, tx pgx.Tx, userID int, family string, ttl SessionTTL) (Session, error) {
+	now := time.Now()
+	session := Session{
+		UserID:         userID,
+		RefreshToken:   uuid.NewString(),
+		RefreshExpires: now.Add(ttl.Refresh),
+	}
+
+	_, err := tx.Exec(ctx,
+		"insert into tokens (token_hash, user_id, expires, family, refresh) values ($1,$2,$3,$4,true)",
+		hashToken(session.RefreshToken), userID, session.RefreshExpires, family)
+	if err != nil {
+		return Session{}, mapError(err)
+	}
+
+	if ttl.Access > 0 {
+		session.AccessToken = uuid.NewString()
+		session.AccessExpires = now.Add(ttl.Access)
+
+		_, err = tx.Exec(ctx,
+			"insert into tokens (token_hash, user_id, expires, family) values ($1,$2,$3,$4)",
+			hashToken(session.AccessToken), userID, session.AccessExpires, family)
+		if err != nil {
+			return Session{}, mapError(err)
+		}
+	}
+
+	return session, nil
+}
+
+func (d *DatabaseStore) IsLoggedIn(ctx context.Context, token string) (bool, int, int) {
+	var userId int
+	var accessLevel int
+	err := d.pool.QueryRow(ctx,
+		"select u.id, u.access_level from tokens t inner join users u on t.user_id = u.id where t.token_hash = $1 and not t.refresh and t.expires > now()", hashToken(token)).
+		Scan(&userId, &accessLevel)
+	if err != nil { // No register (or the query failed), meaning the user is not logged in
+		return false, -1, -1
+	}
+
+	return true, userId, accessLevel
+}
+
+func (d *DatabaseStore) DeleteSession(ctx context.Context, userID int, token string) error {
+	tag, err := d.pool.Exec(ctx,
+		"delete from tokens where family = (select family from tokens where token_hash = $1 and user_id = $2)",
+		hashToken(token), userID)
+	if err != nil {
+		return mapError(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("session: %w", ErrNotFound)
+	}
+
+	return nil
 }
 
-func NewDatabaseStore(connectString string) (*DatabaseStore, error) {
-	conn, err := pgx.Connect(context.Background(), connectString)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to connect to database: %v\n", err)
+func (d *DatabaseStore) DeleteUserTokens(ctx context.Context, userID int) error {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		"delete from tokens where user_id = $1", userID)
+	if err != nil {
+		return mapError(err)
+	}
+
+	err = revokeTokens(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	return mapError(tx.Commit(ctx))
+}
+
+// revokeTokens bumps the token version of the user inside the transaction, revoking their signed access tokens
+func revokeTokens(ctx context.Context, tx pgx.Tx, userID int) error {
+	_, err := tx.Exec(ctx,
+		"update users set token_version = token_version + 1, tokens_revoked = now() where id = $1", userID)
+
+	return mapError(err)
+}
+
+func (d *DatabaseStore) GetTokenVersion(ctx context.Context, userID int) (int, error) {
+	var version int
+	err := d.pool.QueryRow(ctx,
+		"select token_version from users where id = $1", userID).
+		Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("user %d: %w", userID, mapError(err))
+	}
+
+	return version, nil
+}
+
+func (d *DatabaseStore) GetRevokedTokenVersions(ctx context.Context, since time.Time) (map[int]int, error) {
+	rows, err := d.pool.Query(ctx,
+		"select id, token_version from users where tokens_revoked >= $1", since)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	versions := map[int]int{}
+	for rows.Next() {
+		var userID, version int
+		err = rows.Scan(&userID, &version)
+		if err != nil {
+			return nil, mapError(err)
+		}
+		versions[userID] = version
+	}
+
+	return versions, mapError(rows.Err())
+}
+
+func (d *DatabaseStore) DeleteExpiredTokens(ctx context.Context) (int64, error) {
+	tag, err := d.pool.Exec(ctx,
+		"delete from tokens where expires <= now()")
+	if err != nil {
+		return 0, mapError(err)
+	}
+
+	userTag, err := d.pool.Exec(ctx,
+		"delete from user_tokens where expires <= now()")
+	if err != nil {
+		return 0, mapError(err)
+	}
+
+	// Login failures are forgotten after the throttle window anyway, which is at most a day
+	_, err = d.pool.Exec(ctx,
+		"delete from login_failures where last_failure < now() - interval '1 day' and (locked_until is null or locked_until < now())")
+	if err != nil {
+		return 0, mapError(err)
+	}
+
+	return tag.RowsAffected() + userTag.RowsAffected(), nil
+}
+
+func (d *DatabaseStore) LoginLockedUntil(ctx context.Context, keys ...string) (time.Time, error) {
+	var lockedUntil pgtype.Timestamptz
+	err := d.pool.QueryRow(ctx,
+		"select max(locked_until) from login_failures where key = any($1)", keys).
+		Scan(&lockedUntil)
+	if err != nil {
+		return time.Time{}, mapError(err)
+	}
+
+	return lockedUntil.Time, nil
+}
+
+func (d *DatabaseStore) RecordLoginFailure(ctx context.Context, key string, throttle LoginThrottle) (time.Time, error) {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return time.Time{}, mapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Start counting again if the last failure is out of the window
+	var failures int
+	err = tx.QueryRow(ctx,
+		`insert into login_failures (key, failures, last_failure) values ($1, 1, now())
+		on conflict (key) do update set
+			failures = case when login_failures.last_failure < $2 then 1 else login_failures.failures + 1 end,
+			last_failure = now()
+		returning failures`,
+		key, time.Now().Add(-throttle.Window)).
+		Scan(&failures)
+	if err != nil {
+		return time.Time{}, mapError(err)
+	}
+
+	var lockedUntil time.Time
+	if lock := throttle.lockFor(failures); lock > 0 {
+		lockedUntil = time.Now().Add(lock)
+		_, err = tx.Exec(ctx,
+			"update login_failures set locked_until = $1 where key = $2", lockedUntil, key)
+		if err != nil {
+			return time.Time{}, mapError(err)
+		}
+	}
+
+	return lockedUntil, mapError(tx.Commit(ctx))
+}
+
+func (d *DatabaseStore) ResetLoginFailures(ctx context.Context, key string) error {
+	_, err := d.pool.Exec(ctx,
+		"delete from login_failures where key = $1", key)
+
+	return mapError(err)
+}
+
+func (d *DatabaseStore) CreateEmailVerification(ctx context.Context, email string, ttl time.Duration) (string, error) {
+	var userID int
+	var verified bool
+	err := d.pool.QueryRow(ctx,
+		"select id, email_verified is not null from users where email = $1", normalizeEmail(email)).
+		Scan(&userID, &verified)
+	if err != nil {
+		return "", fmt.Errorf("user %s: %w", email, mapError(err))
+	}
+
+	if verified {
+		return "", fmt.Errorf("email %s already verified: %w", email, ErrConflict)
+	}
+
+	token := uuid.NewString()
+	_, err = d.pool.Exec(ctx,
+		"insert into user_tokens (user_id, purpose, token_hash, expires) values ($1,$2,$3,$4)",
+		userID, UserTokenVerifyEmail, hashToken(token), time.Now().Add(ttl))
+	if err != nil {
+		return "", mapError(err)
+	}
+
+	return token, nil
+}
+
+func (d *DatabaseStore) VerifyEmail(ctx context.Context, token string) error {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Deleting the token makes it one-time, even if two requests use it at once
+	var userID int
+	err = tx.QueryRow(ctx,
+		"delete from user_tokens where token_hash = $1 and purpose = $2 and expires > now() returning user_id",
+		hashToken(token), UserTokenVerifyEmail).
+		Scan(&userID)
+	if err != nil {
+		return fmt.Errorf("verification token: %w", mapError(err))
+	}
+
+	_, err = tx.Exec(ctx,
+		"update users set email_verified = now() where id = $1 and email_verified is null", userID)
+	if err != nil {
+		return mapError(err)
+	}
+
+	return mapError(tx.Commit(ctx))
+}
+
+func (d *DatabaseStore) ChangePassword(ctx context.Context, userID int, currentPassword string, newPassword string) error {
+	hashedPass, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	var storedPass string
+	err = tx.QueryRow(ctx,
+		"select password from users where id = $1 for update", userID).
+		Scan(&storedPass)
+	if err != nil {
+		return fmt.Errorf("user %d: %w", userID, mapError(err))
+	}
+
+	match, _, err := checkPassword(currentPassword, storedPass)
+	if err != nil {
+		return fmt.Errorf("user %d: %w", userID, err)
+	}
+	if !match {
+		return fmt.Errorf("%w: wrong current password", ErrUnauthorized)
+	}
+
+	err = setPassword(ctx, tx, userID, hashedPass)
+	if err != nil {
+		return err
+	}
+
+	return mapError(tx.Commit(ctx))
+}
+
+func (d *DatabaseStore) CreatePasswordReset(ctx context.Context, email string, ttl time.Duration) (string, error) {
+	token := uuid.NewString()
+	tag, err := d.pool.Exec(ctx,
+		"insert into user_tokens (user_id, purpose, token_hash, expires) select id, $2, $3, $4 from users where email = $1",
+		normalizeEmail(email), UserTokenResetPassword, hashToken(token), time.Now().Add(ttl))
+	if err != nil {
+		return "", mapError(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return "", fmt.Errorf("user %s: %w", email, ErrNotFound)
+	}
+
+	return token, nil
+}
+
+func (d *DatabaseStore) ResetPassword(ctx context.Context, token string, newPassword string) error {
+	hashedPass, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	var userID int
+	err = tx.QueryRow(ctx,
+		"delete from user_tokens where token_hash = $1 and purpose = $2 and expires > now() returning user_id",
+		hashToken(token), UserTokenResetPassword).
+		Scan(&userID)
+	if err != nil {
+		return fmt.Errorf("password reset token: %w", mapError(err))
+	}
+
+	err = setPassword(ctx, tx, userID, hashedPass)
+	if err != nil {
+		return err
+	}
+
+	// The other reset links are useless now, and getting one proves the email works
+	_, err = tx.Exec(ctx,
+		"delete from user_tokens where user_id = $1 and purpose = $2", userID, UserTokenResetPassword)
+	if err != nil {
+		return mapError(err)
+	}
+
+	_, err = tx.Exec(ctx,
+		"update users set email_verified = now() where id = $1 and email_verified is null", userID)
+	if err != nil {
+		return mapError(err)
+	}
+
+	return mapError(tx.Commit(ctx))
+}
+
+// setPassword saves the hash of a new password, deletes the tokens of the user and revokes their signed access
+// tokens, inside the transaction
+func setPassword(ctx context.Context, tx pgx.Tx, userID int, hashedPass string) error {
+	_, err := tx.Exec(ctx,
+		"update users set password = $1 where id = $2", hashedPass, userID)
+	if err != nil {
+		return mapError(err)
+	}
+
+	_, err = tx.Exec(ctx,
+		"delete from tokens where user_id = $1", userID)
+	if err != nil {
+		return mapError(err)
+	}
+
+	return revokeTokens(ctx, tx, userID)
+}
+
+func (d *DatabaseStore) CountUserTokens(ctx context.Context, email string, purpose string, since time.Time) (int, error) {
+	var count int
+	err := d.pool.QueryRow(ctx,
+		"select count(*) from user_tokens t inner join users u on t.user_id = u.id where u.email = $1 and t.purpose = $2 and t.created > $3",
+		normalizeEmail(email), purpose, since).
+		Scan(&count)
+
+	return count, mapError(err)
+}
+
+func (d *DatabaseStore) GetAllCategories(ctx context.Context) ([]Category, error) {
+	var categories []Category
+
+	rows, err := d.pool.Query(ctx,
+		"select * from categories")
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		category := Category{}
+		err := rows.Scan(&category.Id, &category.Name, &category.Created)
+		if err != nil {
+			return nil, mapError(err)
+		}
+
+		categories = append(categories, category)
+	}
+
+	return categories, mapError(rows.Err())
+}
+
+func (d *DatabaseStore) AddCategory(ctx context.Context, name string) error {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		`insert into categories (name) values ($1)`, name)
+	if err != nil {
+		return mapError(err)
+	}
+
+	return mapError(tx.Commit(ctx))
+}
+
+func (d *DatabaseStore) AddUser(ctx context.Context, user User) error {
+	hashedPass, err := hashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Get ID from user. It must come from the same transaction, since other pool connections
+	// cannot see the user until it is committed. An existing email fails with ErrConflict.
+	var userId int
+	err = tx.QueryRow(ctx,
+		`insert into users (name, email, password, access_level, birth_date, city, profile_picture, description) values ($1,$2,$3,$4,$5,$6,$7,$8) returning id`,
+		user.Name, normalizeEmail(user.Email), hashedPass, UserAccessLevel, user.BirthDate, user.City, user.ProfilePicture, user.Description).
+		Scan(&userId)
+	if err != nil {
+		return mapError(err)
+	}
+
+	// Insert new users_categories
+	for _, category := range user.Categories {
+		_, err = tx.Exec(ctx,
+			`insert into users_categories (user_id, category_id) values ($1,$2)`, userId, category)
+		if err != nil {
+			return mapError(err)
+		}
+	}
+
+	return mapError(tx.Commit(ctx))
+}
+
+func (d *DatabaseStore) GetAllThemeParks(ctx context.Context, filter ParkFilter) ([]ThemePark, error) {
+	var themeparks []ThemePark
+	timeZones := map[int]string{}
+
+	rows, err := d.pool.Query(ctx,
+		"SELECT id, name, picture, time_zone FROM themeparks")
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	for rows.Next() {
+		themepark := ThemePark{}
+		var timeZone string
+		err := rows.Scan(&themepark.Id, &themepark.Name, &themepark.Picture, &timeZone)
+		if err != nil {
+			rows.Close()
+			return nil, mapError(err)
+		}
+
+		themeparks = append(themeparks, themepark)
+		timeZones[themepark.Id] = timeZone
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
+	}
+
+	for i, themepark := range themeparks {
+		// Get categories for themepark
+		themeparks[i].Categories, err = d.getThemeParkCategories(ctx, themepark.Id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Get current prices. The ones that ended before yesterday in UTC can't be current in any time zone.
+	now := time.Now()
+	prices, err := d.queryTicketPrices(ctx,
+		"select "+ticketPriceColumns+" from ticket_prices where valid_to is null or valid_to >= $1",
+		dateToColumn(now.UTC().AddDate(0, 0, -1).Format(dateLayout)))
+	if err != nil {
+		return nil, err
+	}
+
+	pricesByPark := map[int][]TicketPrice{}
+	for _, price := range prices {
+		pricesByPark[price.ThemeparkId] = append(pricesByPark[price.ThemeparkId], price)
+	}
+	for i, themepark := range themeparks {
+		themeparks[i].Prices = currentPrices(pricesByPark[themepark.Id], timeZones[themepark.Id], now)
+	}
+
+	return filterParks(themeparks, filter), nil
+}
+
+func (d *DatabaseStore) GetThemeParkDetail(ctx context.Context, parkID int, filter AttractionFilter) (*ThemePark, error) {
+	var themepark ThemePark
+
+	// Get coordinates
+	var point pgtype.Point
+	var timeZone string
+	err := d.pool.QueryRow(ctx,
+		"SELECT id, name, description, picture, location, time_zone FROM themeparks WHERE id = $1", parkID).
+		Scan(&themepark.Id, &themepark.Name, &themepark.Description, &themepark.Picture, &point, &timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("themepark %d: %w", parkID, mapError(err))
+	}
+
+	themepark.Latitude = point.P.X
+	themepark.Longitude = point.P.Y
+
+	// Get categories for themeparks
+	themepark.Categories, err = d.getThemeParkCategories(ctx, parkID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get comments
+	var comments []Comment
+	rows, err := d.pool.Query(ctx,
+		"select c.id, u.id, u.name, c.comment, c.created from comments c inner join users u on c.user_id = u.id where c.themepark_id = $1 order by c.created", parkID)
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		comment := Comment{}
+		err := rows.Scan(&comment.Id, &comment.UserId, &comment.UserName, &comment.Comment, &comment.Created)
+		if err != nil {
+			return nil, mapError(err)
+		}
+
+		comments = append(comments, comment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
+	}
+
+	themepark.Comments = comments
+
+	// Get attractions
+	themepark.Attractions, err = d.getParkAttractions(ctx, parkID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get wait times
+	now := time.Now()
+	attractionIDs := make([]int, len(themepark.Attractions))
+	for i, attraction := range themepark.Attractions {
+		attractionIDs[i] = attraction.Id
+	}
+	waitTimes, err := d.waitTimes(ctx, attractionIDs, parkLocation(timeZone), now)
+	if err != nil {
+		return nil, err
+	}
+	for i, attraction := range themepark.Attractions {
+		themepark.Attractions[i].WaitTimes = waitTimes[attraction.Id]
+	}
+
+	// Get current prices
+	prices, err := d.queryTicketPrices(ctx,
+		"select "+ticketPriceColumns+" from ticket_prices where themepark_id = $1", parkID)
+	if err != nil {
+		return nil, err
+	}
+	themepark.Prices = currentPrices(prices, timeZone, now)
+
+	return &themepark, nil
+}
+
+// attractionColumns are the columns read by scanAttraction
+const attractionColumns = `id, themepark_id, name, type, status, min_height_cm, max_height_cm, min_age, thrill_level,
+	duration_seconds, capacity_per_hour, wheelchair_accessible, transfer_required, companion_required, sensory_friendly, created`
+
+// scanAttraction scans a row of attractionColumns
+func scanAttraction(row pgx.Row, attraction *Attraction) error {
+	return row.Scan(&attraction.Id, &attraction.ThemeparkId, &attraction.Name, &attraction.Type, &attraction.Status,
+		&attraction.MinHeight, &attraction.MaxHeight, &attraction.MinAge, &attraction.ThrillLevel,
+		&attraction.Duration, &attraction.CapacityPerHour,
+		&attraction.Accessibility.WheelchairAccessible, &attraction.Accessibility.TransferRequired,
+		&attraction.Accessibility.CompanionRequired, &attraction.Accessibility.SensoryFriendly, &attraction.Created)
+}
+
+// getParkAttractions returns the attractions of a theme park that pass the filter, by id
+func (d *DatabaseStore) getParkAttractions(ctx context.Context, parkID int, filter AttractionFilter) ([]Attraction, error) {
+	var attractions []Attraction
+	rows, err := d.pool.Query(ctx,
+		"select "+attractionColumns+" from attractions where themepark_id = $1 order by id", parkID)
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		attraction := Attraction{}
+		err := scanAttraction(rows, &attraction)
+		if err != nil {
+			return nil, mapError(err)
+		}
+
+		attractions = append(attractions, attraction)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
+	}
+
+	return filterAttractions(attractions, filter), nil
+}
+
+func (d *DatabaseStore) InsertParkComment(ctx context.Context, parkID int, userId int, comment string) error {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		`insert into comments (themepark_id, user_id, comment) values ($1,$2,$3)`,
+		parkID, userId, comment)
+	if err != nil {
+		return mapError(err)
+	}
+
+	return mapError(tx.Commit(ctx))
+}
+
+func (d *DatabaseStore) GetThemeParkFromName(ctx context.Context, name string) (*ThemePark, error) {
+	var themePark ThemePark
+	err := d.pool.QueryRow(ctx,
+		"select id, name, description, picture from themeparks where name = $1", name).
+		Scan(&themePark.Id, &themePark.Name, &themePark.Description, &themePark.Picture)
+	if err != nil {
+		return nil, fmt.Errorf("themepark %s: %w", name, mapError(err))
+	}
+
+	return &themePark, nil
+}
+
+func (d *DatabaseStore) AddThemePark(ctx context.Context, themePark ThemePark) error {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Get ID from the theme park within the same transaction. An existing name fails with ErrConflict.
+	var themeParkId int
+	err = tx.QueryRow(ctx,
+		`insert into themeparks (name, location, description, picture) values ($1, POINT($2,$3), $4, $5) returning id`,
+		themePark.Name, themePark.Latitude, themePark.Longitude, themePark.Description, themePark.Picture).
+		Scan(&themeParkId)
+	if err != nil {
+		return mapError(err)
+	}
+
+	// Insert new themeparks_categories
+	for _, category := range themePark.Categories {
+		_, err = tx.Exec(ctx,
+			`insert into themeparks_categories (themepark_id, category_id) values ($1,$2)`, themeParkId, category.Id)
+		if err != nil {
+			return mapError(err)
+		}
+	}
+
+	return mapError(tx.Commit(ctx))
+}
+
+func (d *DatabaseStore) DeleteThemePark(ctx context.Context, id int) error {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		`DELETE FROM themeparks WHERE id = $1`, id)
+	if err != nil {
+		return mapError(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("themepark %d: %w", id, ErrNotFound)
 	}
 
-	return &DatabaseStore{conn: conn}, nil
+	return mapError(tx.Commit(ctx))
 }
 
-func (d *DatabaseStore) Close() {
-	d.conn.Close(context.Background())
-}
+func (d *DatabaseStore) UpdateThemePark(ctx context.Context, themePark ThemePark) error {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback(ctx)
 
-func (d *DatabaseStore) GetUser(userID int) (*User, error) {
-	var user User
-	err := d.conn.QueryRow(context.Background(),
-		"select id, name, email, password, access_level, birth_date, city, profile_picture, description from users where id = $1", userID).
-		Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.AccessLevel, &user.BirthDate, &user.City, &user.ProfilePicture, &user.Description)
+	tag, err := tx.Exec(ctx,
+		`update themeparks set name = $1, location = POINT($2,$3), description = $4, picture = $5 where id = $6`,
+		themePark.Name, themePark.Latitude, themePark.Longitude, themePark.Description, themePark.Picture, themePark.Id)
 	if err != nil {
-		return nil, err
+		return mapError(err)
 	}
 
-	// Get categories for user
-	var userCategories []int
-	rows, _ := d.conn.Query(context.Background(),
-		"select * from users_categories where user_id = $1", userID)
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("themepark %d: %w", themePark.Id, ErrNotFound)
+	}
 
-	defer rows.Close()
-	for rows.Next() {
-		userCategory := UsersCategory{}
-		err := rows.Scan(&userCategory.Id, &userCategory.UserId, &userCategory.CategoryId, &userCategory.Created)
+	// Delete all categories for that themepark
+	_, err = tx.Exec(ctx,
+		`delete from themeparks_categories where themepark_id = $1`, themePark.Id)
+	if err != nil {
+		return mapError(err)
+	}
+
+	// Add new categories
+	for _, category := range themePark.Categories {
+		_, err = tx.Exec(ctx,
+			`insert into themeparks_categories (themepark_id, category_id) values ($1,$2)`, themePark.Id, category.Id)
 		if err != nil {
-			return nil, err
+			return mapError(err)
 		}
-
-		userCategories = append(userCategories, userCategory.CategoryId)
 	}
 
-	// Add categories
-	user.Categories = userCategories
+	return mapError(tx.Commit(ctx))
+}
 
-	return &user, nil
+func (d *DatabaseStore) GetParkAttractions(ctx context.Context, parkID int, filter AttractionFilter) ([]Attraction, error) {
+	var exists bool
+	err := d.pool.QueryRow(ctx,
+		"select exists (select 1 from themeparks where id = $1)", parkID).
+		Scan(&exists)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("themepark %d: %w", parkID, ErrNotFound)
+	}
+
+	return d.getParkAttractions(ctx, parkID, filter)
 }
 
-func (d *DatabaseStore) UpdateUser(user User) error {
-	tx, err := d.conn.Begin(context.Background())
+func (d *DatabaseStore) GetAttraction(ctx context.Context, parkID int, attractionID int) (*Attraction, error) {
+	var attraction Attraction
+	err := scanAttraction(d.pool.QueryRow(ctx,
+		"select "+attractionColumns+" from attractions where id = $1 and themepark_id = $2", attractionID, parkID),
+		&attraction)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("attraction %d of themepark %d: %w", attractionID, parkID, mapError(err))
 	}
-	defer tx.Rollback(context.Background())
 
-	// Update user
-	_, err = tx.Exec(context.Background(),
-		"update users set name = $1, birth_date = $2, city = $3, profile_picture = $4, description = $5 where id = $6",
-		user.Name, user.BirthDate, user.City, user.ProfilePicture, user.Description, user.ID)
+	return &attraction, nil
+}
 
+func (d *DatabaseStore) AddAttraction(ctx context.Context, attraction Attraction) (int, error) {
+	// Selecting the park makes an unknown park a ErrNotFound instead of a foreign key violation
+	var attractionID int
+	err := d.pool.QueryRow(ctx,
+		`insert into attractions (themepark_id, name, type, status, min_height_cm, max_height_cm, min_age, thrill_level,
+			duration_seconds, capacity_per_hour, wheelchair_accessible, transfer_required, companion_required, sensory_friendly)
+		select id, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14 from themeparks where id = $1 returning id`,
+		attraction.ThemeparkId, attraction.Name, attraction.Type, attraction.Status,
+		attraction.MinHeight, attraction.MaxHeight, attraction.MinAge, attraction.ThrillLevel,
+		attraction.Duration, attraction.CapacityPerHour,
+		attraction.Accessibility.WheelchairAccessible, attraction.Accessibility.TransferRequired,
+		attraction.Accessibility.CompanionRequired, attraction.Accessibility.SensoryFriendly).
+		Scan(&attractionID)
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("themepark %d: %w", attraction.ThemeparkId, mapError(err))
 	}
 
-	// Remove categories
-	_, err = tx.Exec(context.Background(),
-		"delete from users_categories where user_id = $1", user.ID)
+	return attractionID, nil
+}
 
+func (d *DatabaseStore) UpdateAttraction(ctx context.Context, attraction Attraction) error {
+	tag, err := d.pool.Exec(ctx,
+		`update attractions set name = $1, type = $2, status = $3, min_height_cm = $4, max_height_cm = $5, min_age = $6,
+			thrill_level = $7, duration_seconds = $8, capacity_per_hour = $9, wheelchair_accessible = $10,
+			transfer_required = $11, companion_required = $12, sensory_friendly = $13
+		where id = $14 and themepark_id = $15`,
+		attraction.Name, attraction.Type, attraction.Status, attraction.MinHeight, attraction.MaxHeight, attraction.MinAge,
+		attraction.ThrillLevel, attraction.Duration, attraction.CapacityPerHour, attraction.Accessibility.WheelchairAccessible,
+		attraction.Accessibility.TransferRequired, attraction.Accessibility.CompanionRequired, attraction.Accessibility.SensoryFriendly,
+		attraction.Id, attraction.ThemeparkId)
 	if err != nil {
-		return err
+		return mapError(err)
 	}
 
-	// Update categories
-	_, err = tx.Exec(context.Background(),
-		"delete from users_categories where user_id = $1", user.ID)
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("attraction %d of themepark %d: %w", attraction.Id, attraction.ThemeparkId, ErrNotFound)
+	}
+
+	return nil
+}
 
+func (d *DatabaseStore) DeleteAttraction(ctx context.Context, parkID int, attractionID int) error {
+	tag, err := d.pool.Exec(ctx,
+		`delete from attractions where id = $1 and themepark_id = $2`, attractionID, parkID)
 	if err != nil {
-		return err
+		return mapError(err)
 	}
 
-	for _, category := range user.Categories {
-		_, err = tx.Exec(context.Background(),
-			`insert into users_categories (user_id, category_id) values ($1,$2)`, user.ID, category)
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("attraction %d of themepark %d: %w", attractionID, parkID, ErrNotFound)
 	}
 
-	tx.Commit(context.Background())
 	return nil
 }
 
-func (d *DatabaseStore) GetAllUsers() ([]User, error) {
-	var users []User
+// ticketPriceColumns are the columns read by scanTicketPrice
+const ticketPriceColumns = "id, themepark_id, tier, amount_cents, currency, valid_from, valid_to, created"
+
+// scanTicketPrice scans a row of ticketPriceColumns
+func scanTicketPrice(row pgx.Row, price *TicketPrice) error {
+	var validFrom, validTo pgtype.Date
+	err := row.Scan(&price.Id, &price.ThemeparkId, &price.Tier, &price.AmountCents, &price.Currency,
+		&validFrom, &validTo, &price.Created)
+	if err != nil {
+		return err
+	}
+
+	price.ValidFrom = dateFromColumn(validFrom)
+	price.ValidTo = dateFromColumn(validTo)
+
+	return nil
+}
 
-	rows, _ := d.conn.Query(context.Background(),
-		"select id, name, email, access_level, birth_date, city, profile_picture, description from users")
+// queryTicketPrices returns the ticket prices of a query selecting ticketPriceColumns, sorted
+func (d *DatabaseStore) queryTicketPrices(ctx context.Context, sql string, args ...any) ([]TicketPrice, error) {
+	var prices []TicketPrice
+	rows, err := d.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, mapError(err)
+	}
 
+	defer rows.Close()
 	for rows.Next() {
-		user := User{}
-		err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.AccessLevel, &user.BirthDate, &user.City, &user.ProfilePicture, &user.Description)
+		price := TicketPrice{}
+		err := scanTicketPrice(rows, &price)
 		if err != nil {
-			return nil, err
+			return nil, mapError(err)
 		}
 
-		users = append(users, user)
+		prices = append(prices, price)
 	}
-	rows.Close()
-
-	for i, user := range users {
-		// Get categories for user
-		var userCategories []int
-		rows, _ := d.conn.Query(context.Background(),
-			"select * from users_categories where user_id = $1", user.ID)
 
-		for rows.Next() {
-			userCategory := UsersCategory{}
-			err := rows.Scan(&userCategory.Id, &userCategory.UserId, &userCategory.CategoryId, &userCategory.Created)
-			if err != nil {
-				return nil, err
-			}
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
+	}
 
-			userCategories = append(userCategories, userCategory.CategoryId)
-		}
+	sortTicketPrices(prices)
 
-		users[i].Categories = userCategories
+	return prices, nil
+}
 
-		rows.Close()
+func (d *DatabaseStore) GetParkTicketPrices(ctx context.Context, parkID int) ([]TicketPrice, error) {
+	var exists bool
+	err := d.pool.QueryRow(ctx,
+		"select exists (select 1 from themeparks where id = $1)", parkID).
+		Scan(&exists)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("themepark %d: %w", parkID, ErrNotFound)
 	}
 
-	return users, nil
+	return d.queryTicketPrices(ctx,
+		"select "+ticketPriceColumns+" from ticket_prices where themepark_id = $1", parkID)
 }
 
-func (d *DatabaseStore) GetUserFromEmail(email string) (*User, error) {
-	var user User
-	err := d.conn.QueryRow(context.Background(),
-		"select id, name, email, password, access_level, birth_date, city, profile_picture, description from users where email = $1", email).
-		Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.AccessLevel, &user.BirthDate, &user.City, &user.ProfilePicture, &user.Description)
+func (d *DatabaseStore) GetTicketPrice(ctx context.Context, parkID int, priceID int) (*TicketPrice, error) {
+	var price TicketPrice
+	err := scanTicketPrice(d.pool.QueryRow(ctx,
+		"select "+ticketPriceColumns+" from ticket_prices where id = $1 and themepark_id = $2", priceID, parkID),
+		&price)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("ticket price %d of themepark %d: %w", priceID, parkID, mapError(err))
 	}
 
-	return &user, nil
+	return &price, nil
 }
 
-func (d *DatabaseStore) SignIn(userEmail string, userPass string) (string, int, error) {
-	var user User
-	err := d.conn.QueryRow(context.Background(),
-		"select id, email, password from users where email = $1", userEmail).
-		Scan(&user.ID, &user.Email, &user.Password)
-
+func (d *DatabaseStore) AddTicketPrice(ctx context.Context, price TicketPrice) (int, error) {
+	tx, err := d.pool.Begin(ctx)
 	if err != nil {
-		return "", 0, err
+		return 0, mapError(err)
 	}
+	defer tx.Rollback(ctx)
 
-	// Check if password matches
-	digest := sha256.Sum256([]byte(userPass))
-	hashedPass := fmt.Sprintf("%x", digest)
-	if hashedPass == user.Password {
-		token := uuid.New()
-		d.conn.Exec(context.Background(),
-			"insert into tokens (token, user_id) values ($1,$2)", token.String(), user.ID)
-		return token.String(), user.ID, nil
+	err = lockParkTicketPrices(ctx, tx, price.ThemeparkId)
+	if err != nil {
+		return 0, err
 	}
 
-	return "", 0, errors.New(fmt.Sprintf("Invalid user password for user %s", userEmail))
-}
-
-func (d *DatabaseStore) IsLoggedIn(token string) (bool, int, int) {
-	var userId int
-	var accessLevel int
-	rows, _ := d.conn.Query(context.Background(),
-		"select u.id, u.access_level from tokens t inner join users u on t.user_id = u.id where t.token = $1", token)
+	err = checkTicketPriceOverlap(ctx, tx, price)
+	if err != nil {
+		return 0, err
+	}
 
-	for rows.Next() { // This means a register exist, meaning the user is logged in
-		_ = rows.Scan(&userId, &accessLevel)
-		rows.Close()
-		return true, userId, accessLevel
+	var priceID int
+	err = tx.QueryRow(ctx,
+		`insert into ticket_prices (themepark_id, tier, amount_cents, currency, valid_from, valid_to)
+		values ($1, $2, $3, $4, $5, $6) returning id`,
+		price.ThemeparkId, price.Tier, price.AmountCents, price.Currency,
+		dateToColumn(price.ValidFrom), dateToColumn(price.ValidTo)).
+		Scan(&priceID)
+	if err != nil {
+		return 0, mapError(err)
 	}
 
-	return false, -1, -1
+	return priceID, mapError(tx.Commit(ctx))
 }
 
-func (d *DatabaseStore) GetAllCategories() ([]Category, error) {
-	var categories []Category
+func (d *DatabaseStore) UpdateTicketPrice(ctx context.Context, price TicketPrice) error {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback(ctx)
 
-	rows, _ := d.conn.Query(context.Background(),
-		"select * from categories")
+	err = lockParkTicketPrices(ctx, tx, price.ThemeparkId)
+	if err != nil {
+		return err
+	}
 
-	defer rows.Close()
-	for rows.Next() {
-		category := Category{}
-		err := rows.Scan(&category.Id, &category.Name, &category.Created)
-		if err != nil {
-			return nil, err
-		}
+	tag, err := tx.Exec(ctx,
+		`update ticket_prices set tier = $1, amount_cents = $2, currency = $3, valid_from = $4, valid_to = $5
+		where id = $6 and themepark_id = $7`,
+		price.Tier, price.AmountCents, price.Currency, dateToColumn(price.ValidFrom), dateToColumn(price.ValidTo),
+		price.Id, price.ThemeparkId)
+	if err != nil {
+		return mapError(err)
+	}
 
-		categories = append(categories, category)
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("ticket price %d of themepark %d: %w", price.Id, price.ThemeparkId, ErrNotFound)
+	}
+
+	// Checked after the update, so a missing price is a ErrNotFound. A conflict rolls it back.
+	err = checkTicketPriceOverlap(ctx, tx, price)
+	if err != nil {
+		return err
 	}
 
-	return categories, nil
+	return mapError(tx.Commit(ctx))
 }
 
-func (d *DatabaseStore) AddCategory(name string) error {
-	tx, err := d.conn.Begin(context.Background())
+// lockParkTicketPrices locks a park, so its prices are changed one at a time and can't overlap
+func lockParkTicketPrices(ctx context.Context, tx pgx.Tx, parkID int) error {
+	var id int
+	err := tx.QueryRow(ctx,
+		"select id from themeparks where id = $1 for update", parkID).
+		Scan(&id)
 	if err != nil {
-		return err
+		return fmt.Errorf("themepark %d: %w", parkID, mapError(err))
 	}
-	defer tx.Rollback(context.Background())
 
-	_, err = tx.Exec(context.Background(),
-		`insert into categories (name) values ($1)`, name)
+	return nil
+}
 
+// checkTicketPriceOverlap fails with ErrConflict if another price of the tier is valid on the same dates
+func checkTicketPriceOverlap(ctx context.Context, tx pgx.Tx, price TicketPrice) error {
+	// NULL dates are open ended
+	var overlaps bool
+	err := tx.QueryRow(ctx,
+		`select exists (select 1 from ticket_prices where themepark_id = $1 and tier = $2 and id <> $3
+			and (valid_from is null or $5::date is null or valid_from <= $5::date)
+			and (valid_to is null or $4::date is null or valid_to >= $4::date))`,
+		price.ThemeparkId, price.Tier, price.Id, dateToColumn(price.ValidFrom), dateToColumn(price.ValidTo)).
+		Scan(&overlaps)
 	if err != nil {
-		return err
+		return mapError(err)
 	}
 
-	tx.Commit(context.Background())
+	if overlaps {
+		return fmt.Errorf("%s price valid on the same dates %w", price.Tier, ErrConflict)
+	}
 
 	return nil
 }
 
-func (d *DatabaseStore) AddUser(user User) error {
-	// TODO: Check if user already in the db
+func (d *DatabaseStore) DeleteTicketPrice(ctx context.Context, parkID int, priceID int) error {
+	tag, err := d.pool.Exec(ctx,
+		`delete from ticket_prices where id = $1 and themepark_id = $2`, priceID, parkID)
+	if err != nil {
+		return mapError(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("ticket price %d of themepark %d: %w", priceID, parkID, ErrNotFound)
+	}
 
-	passDigest := sha256.Sum256([]byte(user.Password))
-	hashedPass := fmt.Sprintf("%x", passDigest)
+	return nil
+}
 
-	tx, err := d.conn.Begin(context.Background())
+func (d *DatabaseStore) AddWaitTimeReport(ctx context.Context, parkID int, report WaitTimeReport) error {
+	// Selecting the attraction checks that it belongs to the park
+	tag, err := d.pool.Exec(ctx,
+		`insert into wait_time_reports (attraction_id, user_id, wait_minutes)
+		select id, $3, $4 from attractions where id = $1 and themepark_id = $2`,
+		report.AttractionId, parkID, report.UserId, report.WaitMinutes)
 	if err != nil {
-		return err
+		return mapError(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("attraction %d of themepark %d: %w", report.AttractionId, parkID, ErrNotFound)
 	}
-	defer tx.Rollback(context.Background())
 
-	_, err = tx.Exec(context.Background(),
-		`insert into users (name, email, password, access_level, birth_date, city, profile_picture, description) values ($1,$2,$3,$4,$5,$6,$7,$8)`,
-		user.Name, user.Email, hashedPass, 1, user.BirthDate, user.City, user.ProfilePicture, user.Description)
+	return nil
+}
 
-	// Get ID from user
-	userWithId, err := d.GetUserFromEmail(user.Email)
+func (d *DatabaseStore) GetWaitTimes(ctx context.Context, parkID int, attractionID int) (*WaitTimes, error) {
+	// Selecting the time zone checks that the attraction belongs to the park
+	var timeZone string
+	err := d.pool.QueryRow(ctx,
+		"select t.time_zone from attractions a inner join themeparks t on a.themepark_id = t.id where a.id = $1 and t.id = $2",
+		attractionID, parkID).
+		Scan(&timeZone)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("attraction %d of themepark %d: %w", attractionID, parkID, mapError(err))
 	}
 
-	// Insert new users_categories
-	for _, category := range user.Categories {
-		_, err = tx.Exec(context.Background(),
-			`insert into users_categories (user_id, category_id) values ($1,$2)`, userWithId.ID, category)
+	waitTimes, err := d.waitTimes(ctx, []int{attractionID}, parkLocation(timeZone), time.Now())
+	if err != nil {
+		return nil, err
 	}
 
-	tx.Commit(context.Background())
-
-	return nil
+	return waitTimes[attractionID], nil
 }
 
-func (d *DatabaseStore) GetAllThemeParks() ([]ThemePark, error) {
-	var themeparks []ThemePark
+// waitHistoryQuery averages the reports of the attractions $1 since $2 by hour and by ISO weekday in the time zone
+// $3. Like withoutOutliers, buckets of 3 reports or more leave out the ones further than $4 scaled MADs, and over
+// $5 minutes, from their median.
+const waitHistoryQuery = `with reports as (
+		select attraction_id, wait_minutes::float8 as minutes,
+			extract(hour from created at time zone $3)::int as hour,
+			extract(isodow from created at time zone $3)::int as weekday
+		from wait_time_reports where attraction_id = any($1) and created >= $2
+	), buckets as (
+		select attraction_id, 'hour' as kind, hour as bucket, minutes from reports
+		union all
+		select attraction_id, 'weekday', weekday, minutes from reports
+	), medians as (
+		select attraction_id, kind, bucket, count(*) as reports,
+			percentile_cont(0.5) within group (order by minutes) as median
+		from buckets group by attraction_id, kind, bucket
+	), deviations as (
+		select b.attraction_id, b.kind, b.bucket, b.minutes, m.reports, abs(b.minutes - m.median) as deviation
+		from buckets b inner join medians m using (attraction_id, kind, bucket)
+	), limits as (
+		select attraction_id, kind, bucket,
+			case when min(reports) < 3 then 'infinity'::float8
+			else greatest($4::float8 * 1.4826 * percentile_cont(0.5) within group (order by deviation), $5::float8) end as max_deviation
+		from deviations group by attraction_id, kind, bucket
+	)
+	select d.attraction_id, d.kind, d.bucket, round(avg(d.minutes)::numeric, 1)::float8, count(*)
+	from deviations d inner join limits l using (attraction_id, kind, bucket)
+	where d.deviation <= l.max_deviation
+	group by d.attraction_id, d.kind, d.bucket
+	order by d.attraction_id, d.kind, d.bucket`
+
+// waitTimes returns the wait times of the attractions with reports, by attraction id. The history is averaged
+// by the database, so only the reports of the current estimate are read.
+func (d *DatabaseStore) waitTimes(ctx context.Context, attractionIDs []int, location *time.Location, now time.Time) (map[int]*WaitTimes, error) {
+	waitTimes := map[int]*WaitTimes{}
+	of := func(attractionID int) *WaitTimes {
+		if waitTimes[attractionID] == nil {
+			waitTimes[attractionID] = &WaitTimes{}
+		}
+		return waitTimes[attractionID]
+	}
 
-	rows, _ := d.conn.Query(context.Background(),
-		"SELECT id, name, picture FROM themeparks")
+	rows, err := d.pool.Query(ctx, waitHistoryQuery, attractionIDs, now.Add(-waitHistoryWindow), location.String(),
+		float64(outlierMADs), float64(minOutlierMinutes))
+	if err != nil {
+		return nil, mapError(err)
+	}
 
 	defer rows.Close()
 	for rows.Next() {
-		themepark := ThemePark{}
-		err := rows.Scan(&themepark.Id, &themepark.Name, &themepark.Picture)
+		var attractionID, bucket, count int
+		var kind string
+		var average float64
+		err := rows.Scan(&attractionID, &kind, &bucket, &average, &count)
 		if err != nil {
-			rows.Close()
-			return nil, err
+			return nil, mapError(err)
 		}
 
-		themeparks = append(themeparks, themepark)
-	}
-
-	rows.Close()
-
-	for i, themepark := range themeparks {
-		// Get categories for user
-		var parkCategories []Category
-		rows, _ := d.conn.Query(context.Background(),
-			"select c.id, c.name, c.created from themeparks_categories tc inner join categories c on tc.category_id = c.id where tc.themepark_id = $1", themepark.Id)
-
-		for rows.Next() {
-			parkCategory := Category{}
-			err := rows.Scan(&parkCategory.Id, &parkCategory.Name, &parkCategory.Created)
-			if err != nil {
-				rows.Close()
-				return nil, err
-			}
-
-			parkCategories = append(parkCategories, parkCategory)
+		waitTimesOfAttraction := of(attractionID)
+		if kind == "hour" {
+			waitTimesOfAttraction.ByHour = append(waitTimesOfAttraction.ByHour,
+				HourWaitTime{Hour: bucket, AverageMinutes: average, Reports: count})
+		} else {
+			weekday := time.Weekday(bucket % 7) // ISO weekdays go from Monday, 1, to Sunday, 7
+			waitTimesOfAttraction.ByWeekday = append(waitTimesOfAttraction.ByWeekday,
+				WeekdayWaitTime{Weekday: weekdayName(weekday), AverageMinutes: average, Reports: count})
 		}
-
-		themeparks[i].Categories = parkCategories
-
-		rows.Close()
 	}
 
-	return themeparks, nil
-}
-
-func (d *DatabaseStore) GetThemeParkDetail(parkID int) (*ThemePark, error) {
-	var themepark ThemePark
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
+	}
 
-	err := d.conn.QueryRow(context.Background(),
-		"SELECT id, name, description, picture FROM themeparks WHERE id = $1", parkID).
-		Scan(&themepark.Id, &themepark.Name, &themepark.Description, &themepark.Picture)
+	reports, err := d.getWaitTimeReports(ctx, attractionIDs, now.Add(-recentWaitWindow))
 	if err != nil {
 		return nil, err
 	}
 
-	// Get coordinates
-	var point pgtype.Point
-	err = d.conn.QueryRow(context.Background(),
-		"SELECT location FROM themeparks WHERE id = $1", parkID).
-		Scan(&point)
-	if err != nil {
-		return nil, err
+	byAttraction := map[int][]WaitTimeReport{}
+	for _, report := range reports {
+		byAttraction[report.AttractionId] = append(byAttraction[report.AttractionId], report)
+	}
+	for attractionID, reports := range byAttraction {
+		of(attractionID).Current = recentWaitTime(reports, now)
 	}
 
-	themepark.Latitude = point.P.X
-	themepark.Longitude = point.P.Y
+	return waitTimes, nil
+}
 
-	// Get categories for themeparks
-	var categories []Category
-	rows, _ := d.conn.Query(context.Background(),
-		"select c.id, c.name, c.created from themeparks_categories tc  inner join categories c on tc.category_id = c.id where tc.themepark_id = $1", parkID)
+// getWaitTimeReports returns the wait time reports of the attractions since the given time, oldest first
+func (d *DatabaseStore) getWaitTimeReports(ctx context.Context, attractionIDs []int, since time.Time) ([]WaitTimeReport, error) {
+	var reports []WaitTimeReport
+	rows, err := d.pool.Query(ctx,
+		`select id, attraction_id, coalesce(user_id, 0), wait_minutes, created from wait_time_reports
+		where attraction_id = any($1) and created >= $2 order by created`,
+		attractionIDs, since)
+	if err != nil {
+		return nil, mapError(err)
+	}
 
 	defer rows.Close()
 	for rows.Next() {
-		category := Category{}
-		err := rows.Scan(&category.Id, &category.Name, &category.Created)
+		report := WaitTimeReport{}
+		err := rows.Scan(&report.Id, &report.AttractionId, &report.UserId, &report.WaitMinutes, &report.Created)
 		if err != nil {
-			return nil, err
+			return nil, mapError(err)
 		}
 
-		categories = append(categories, category)
+		reports = append(reports, report)
 	}
 
-	themepark.Categories = categories
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
+	}
 
-	// Get comments
-	var comments []Comment
-	rows, _ = d.conn.Query(context.Background(),
-		"select c.id, u.id, u.name, c.comment, c.created from comments c inner join users u on c.user_id = u.id where c.themepark_id = $1 order by c.created", parkID)
+	return reports, nil
+}
+
+func (d *DatabaseStore) GetParkCalendar(ctx context.Context, parkID int) (*ParkCalendar, error) {
+	calendar := ParkCalendar{ThemeparkId: parkID}
+	err := d.pool.QueryRow(ctx,
+		"select name, time_zone from themeparks where id = $1", parkID).
+		Scan(&calendar.ThemeparkName, &calendar.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("themepark %d: %w", parkID, mapError(err))
+	}
+
+	rows, err := d.pool.Query(ctx,
+		"select weekday, opens, closes from park_weekly_hours where themepark_id = $1 order by weekday, opens", parkID)
+	if err != nil {
+		return nil, mapError(err)
+	}
 
 	defer rows.Close()
 	for rows.Next() {
-		comment := Comment{}
-		err := rows.Scan(&comment.Id, &comment.UserId, &comment.UserName, &comment.Comment, &comment.Created)
+		var weekday int
+		var opens, closes pgtype.Time
+		err := rows.Scan(&weekday, &opens, &closes)
 		if err != nil {
-			return nil, err
+			return nil, mapError(err)
 		}
 
-		comments = append(comments, comment)
+		calendar.Weekly = append(calendar.Weekly, WeeklyHours{
+			Weekday: weekdayName(time.Weekday(weekday)),
+			Opens:   clockFromTime(opens),
+			Closes:  clockFromTime(closes),
+		})
 	}
 
-	themepark.Comments = comments
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
+	}
 
-	// Get attractions
-	var attractions []Attraction
-	rows, _ = d.conn.Query(context.Background(),
-		"select * from attractions where themepark_id = $1", parkID)
+	rows, err = d.pool.Query(ctx,
+		"select date, opens, closes, note from park_date_hours where themepark_id = $1 order by date, opens", parkID)
+	if err != nil {
+		return nil, mapError(err)
+	}
 
 	defer rows.Close()
 	for rows.Next() {
-		attraction := Attraction{}
-		err := rows.Scan(&attraction.Id, &attraction.ThemeparkId, &attraction.Name, &attraction.Created)
+		var date time.Time
+		var opens, closes pgtype.Time
+		var exception DateHours
+		err := rows.Scan(&date, &opens, &closes, &exception.Note)
 		if err != nil {
-			return nil, err
+			return nil, mapError(err)
 		}
 
-		attractions = append(attractions, attraction)
+		exception.Date = date.Format(dateLayout)
+		exception.Closed = !opens.Valid
+		if opens.Valid {
+			exception.Opens = clockFromTime(opens)
+			exception.Closes = clockFromTime(closes)
+		}
+		calendar.Exceptions = append(calendar.Exceptions, exception)
 	}
 
-	themepark.Attractions = attractions
-
-	return &themepark, nil
-}
-func (d *DatabaseStore) InsertParkComment(parkID int, userId int, comment string) error {
-	tx, err := d.conn.Begin(context.Background())
-	if err != nil {
-		return err
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
 	}
-	defer tx.Rollback(context.Background())
-
-	_, err = tx.Exec(context.Background(),
-		`insert into comments (themepark_id, user_id, comment) values ($1,$2,$3)`,
-		parkID, userId, comment)
-
-	tx.Commit(context.Background())
 
-	return nil
+	return &calendar, nil
 }
 
-func (d *DatabaseStore) GetThemeParkFromName(name string) (*ThemePark, error) {
-	var themePark ThemePark
-	err := d.conn.QueryRow(context.Background(),
-		"select id, name, description, picture from themeparks where name = $1", name).
-		Scan(&themePark.Id, &themePark.Name, &themePark.Description, &themePark.Picture)
+func (d *DatabaseStore) SetParkCalendar(ctx context.Context, parkID int, calendar ParkCalendar) error {
+	tx, err := d.pool.Begin(ctx)
 	if err != nil {
-		return nil, err
+		return mapError(err)
 	}
+	defer tx.Rollback(ctx)
 
-	return &themePark, nil
-}
-
-func (d *DatabaseStore) AddThemePark(themePark ThemePark) error {
-	tx, err := d.conn.Begin(context.Background())
+	tag, err := tx.Exec(ctx,
+		"update themeparks set time_zone = $1 where id = $2", calendar.TimeZone, parkID)
 	if err != nil {
-		return err
+		return mapError(err)
 	}
-	defer tx.Rollback(context.Background())
 
-	_, err = tx.Exec(context.Background(),
-		`insert into themeparks (name, location, description, picture) values ($1, POINT($2,$3), $4, $5)`,
-		themePark.Name, themePark.Latitude, themePark.Longitude, themePark.Description, themePark.Picture)
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("themepark %d: %w", parkID, ErrNotFound)
+	}
 
-	themeParkWithId, err := d.GetThemeParkFromName(themePark.Name)
+	// Replace the whole calendar
+	_, err = tx.Exec(ctx,
+		"delete from park_weekly_hours where themepark_id = $1", parkID)
 	if err != nil {
-		return err
+		return mapError(err)
+	}
+	_, err = tx.Exec(ctx,
+		"delete from park_date_hours where themepark_id = $1", parkID)
+	if err != nil {
+		return mapError(err)
 	}
 
-	// Insert new themeparks_categories
-	for _, category := range themePark.Categories {
-		_, err = tx.Exec(context.Background(),
-			`insert into themeparks_categories (themepark_id, category_id) values ($1,$2)`, themeParkWithId.Id, category.Id)
+	for _, hours := range calendar.Weekly {
+		weekday, _ := parseWeekday(hours.Weekday)
+		_, err = tx.Exec(ctx,
+			"insert into park_weekly_hours (themepark_id, weekday, opens, closes) values ($1, $2, $3, $4)",
+			parkID, int(weekday), clockToTime(hours.Opens), clockToTime(hours.Closes))
+		if err != nil {
+			return mapError(err)
+		}
 	}
 
-	tx.Commit(context.Background())
-	return nil
-}
+	for _, exception := range calendar.Exceptions {
+		date, err := time.Parse(dateLayout, exception.Date)
+		if err != nil {
+			return &ValidationError{Field: "exceptions", Message: "must be dates as YYYY-MM-DD"}
+		}
 
-func (d *DatabaseStore) DeleteThemePark(id int) error {
-	tx, err := d.conn.Begin(context.Background())
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback(context.Background())
+		// Closed dates have no opening hours
+		var opens, closes pgtype.Time
+		if !exception.Closed {
+			opens, closes = clockToTime(exception.Opens), clockToTime(exception.Closes)
+		}
 
-	_, err = tx.Exec(context.Background(),
-		`DELETE FROM themeparks WHERE id = $1`, id)
-	if err != nil {
-		return err
+		_, err = tx.Exec(ctx,
+			"insert into park_date_hours (themepark_id, date, opens, closes, note) values ($1, $2, $3, $4, $5)",
+			parkID, date, opens, closes, exception.Note)
+		if err != nil {
+			return mapError(err)
+		}
 	}
 
-	tx.Commit(context.Background())
-	return nil
+	return mapError(tx.Commit(ctx))
 }
 
-func (d *DatabaseStore) UpdateThemePark(themePark ThemePark) error {
-	tx, err := d.conn.Begin(context.Background())
+// clockToTime converts a "HH:MM" time to a TIME column, NULL if it isn't valid
+func clockToTime(clock string) pgtype.Time {
+	minutes, err := parseClock(clock)
 	if err != nil {
-		return err
+		return pgtype.Time{}
 	}
-	defer tx.Rollback(context.Background())
 
-	_, err = tx.Exec(context.Background(),
-		`update themeparks set name = $1, location = POINT($2,$3), description = $4, picture = $5 where id = $6`,
-		themePark.Name, themePark.Latitude, themePark.Longitude, themePark.Description, themePark.Picture, themePark.Id)
+	return pgtype.Time{Microseconds: int64(minutes) * int64(time.Minute/time.Microsecond), Valid: true}
+}
+
+// clockFromTime converts a TIME column to a "HH:MM" time
+func clockFromTime(t pgtype.Time) string {
+	return formatClock(int(t.Microseconds / int64(time.Minute/time.Microsecond)))
+}
+
+// dateToColumn converts a YYYY-MM-DD date to a DATE column, NULL if it is empty or isn't valid
+func dateToColumn(date string) pgtype.Date {
+	t, err := time.Parse(dateLayout, date)
 	if err != nil {
-		return err
+		return pgtype.Date{}
 	}
 
-	// Delete all categories for that themepark
-	_, err = tx.Exec(context.Background(),
-		`delete from themeparks_categories where themepark_id = $1`, themePark.Id)
+	return pgtype.Date{Time: t, Valid: true}
+}
 
-	// Add new categories
-	for _, category := range themePark.Categories {
-		_, err = tx.Exec(context.Background(),
-			`insert into themeparks_categories (themepark_id, category_id) values ($1,$2)`, themePark.Id, category.Id)
+// dateFromColumn converts a DATE column to a YYYY-MM-DD date, empty if it is NULL
+func dateFromColumn(d pgtype.Date) string {
+	if !d.Valid {
+		return ""
 	}
 
-	tx.Commit(context.Background())
-	return nil
+	return d.Time.Format(dateLayout)
 }
@@ -0,0 +1,33 @@
+package themepark
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the stores and handlers. Stores wrap them with details, so check them with errors.Is.
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrConflict         = errors.New("already exists")
+	ErrValidation       = errors.New("invalid data")
+	ErrUnauthorized     = errors.New("unauthorized")
+	ErrForbidden        = errors.New("forbidden")
+	ErrBadRequest       = errors.New("bad request")
+	ErrMethodNotAllowed = errors.New("method not allowed")
+	ErrTooManyRequests  = errors.New("too many requests")
+	ErrRequestTooLarge  = errors.New("request too large")
+)
+
+// ValidationError is an ErrValidation about a specific field of the payload.
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
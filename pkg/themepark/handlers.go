@@ -2,326 +2,1504 @@ package themepark
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gorilla/mux"
+	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// Access levels of the users. Routes say which ones they allow with RequireRole.
 const (
-	AdminAccessLevel = 1
-	UserAccessLevel  = 2
+	AdminAccessLevel     = 1
+	UserAccessLevel      = 2
+	ModeratorAccessLevel = 3 // Keeps the parks and categories up to date, without managing users
 )
 
+// DefaultTokenTTL is how long the access tokens returned by SignIn are valid, unless changed with WithTokenTTL
+const DefaultTokenTTL = 24 * time.Hour
+
+// DefaultPublicURL is the base URL of the links sent by email, unless changed with WithPublicURL
+const DefaultPublicURL = "http://localhost:8080"
+
+const (
+	emailVerificationTTL = 48 * time.Hour
+	passwordResetTTL     = time.Hour
+	minPasswordLength    = 8
+	maxMailsPerHour      = 3 // Per email and purpose, so the resend endpoints can't be used to spam someone
+)
+
+// DefaultRefreshTokenTTL is how long refresh tokens are valid, unless changed with WithRefreshTokenTTL
+const DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+
 type Handlers struct {
-	db Store
+	db              Store
+	tokenTTL        time.Duration
+	refreshTokenTTL time.Duration
+
+	// With a signer, access tokens are signed instead of stored
+	signer         *TokenSigner
+	accessTokenTTL time.Duration
+	versions       *TokenVersions // Revoked token versions, nil to only let signed access tokens expire
+
+	mailer    Mailer
+	publicURL string // Base URL of the links sent by email
+
+	clientIPHeader string // Header with the client IP set by a proxy, empty to use the remote address
 }
 
 func NewHandlers(db Store) *Handlers {
-	return &Handlers{db: db}
+	return &Handlers{
+		db:              db,
+		tokenTTL:        DefaultTokenTTL,
+		refreshTokenTTL: DefaultRefreshTokenTTL,
+		accessTokenTTL:  DefaultAccessTokenTTL,
+		mailer:          LogMailer{},
+		publicURL:       DefaultPublicURL,
+	}
 }
 
-func (h *Handlers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("Hello theme park world :)"))
+// errorResponse is the JSON body of every error returned by the API, documented in README.md
+type errorResponse struct {
+	Code      string        `json:"code"`
+	Message   string        `json:"message"`
+	Details   []errorDetail `json:"details,omitempty"`
+	RequestID string        `json:"request_id,omitempty"`
 }
 
-func (h *Handlers) GetUser(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	userID, _ := strconv.Atoi(vars["id"]) // Check error!!!
-	user, err := h.db.GetUser(userID)
+// errorDetail is an error about a specific field of the payload
+type errorDetail struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// WriteError writes err as an errorResponse, with the HTTP status of the package error it wraps. Unknown
+// errors are logged and returned as a generic 500, so database details never reach the client.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	status, code := http.StatusInternalServerError, "internal_error"
+	message := err.Error()
+	requestID := RequestIDFromContext(r.Context())
+
+	switch {
+	case errors.Is(err, ErrNotFound):
+		status, code = http.StatusNotFound, "not_found"
+	case errors.Is(err, ErrConflict):
+		status, code = http.StatusConflict, "conflict"
+	case errors.Is(err, ErrValidation):
+		status, code = http.StatusUnprocessableEntity, "validation_error"
+	case errors.Is(err, ErrUnauthorized):
+		status, code = http.StatusUnauthorized, "unauthorized"
+	case errors.Is(err, ErrForbidden):
+		status, code = http.StatusForbidden, "forbidden"
+	case errors.Is(err, ErrBadRequest):
+		status, code = http.StatusBadRequest, "bad_request"
+	case errors.Is(err, ErrMethodNotAllowed):
+		status, code = http.StatusMethodNotAllowed, "method_not_allowed"
+	case errors.Is(err, ErrTooManyRequests):
+		status, code = http.StatusTooManyRequests, "too_many_requests"
+	case errors.Is(err, ErrRequestTooLarge):
+		status, code = http.StatusRequestEntityTooLarge, "request_too_large"
+	default:
+		log.Printf("Internal error (request %s): %v", requestID, err)
+		message = http.StatusText(status)
+	}
+
+	response := errorResponse{Code: code, Message: message, RequestID: requestID}
+
+	var validationErrs ValidationErrors
+	var validationErr *ValidationError
+	if errors.As(err, &validationErrs) {
+		for _, validationErr := range validationErrs {
+			response.Details = append(response.Details, errorDetail{Field: validationErr.Field, Message: validationErr.Message})
+		}
+	} else if errors.As(err, &validationErr) {
+		response.Details = append(response.Details, errorDetail{Field: validationErr.Field, Message: validationErr.Message})
+	}
+
+	b, _ := json.Marshal(response)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// decodeJSON decodes the body of the request into v, failing with ErrBadRequest on malformed JSON, unknown
+// fields or data after the JSON value, and with ErrRequestTooLarge on bodies over maxBodySize
+func decodeJSON(r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err == nil && decoder.More() {
+		err = errors.New("unexpected data after the JSON value")
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return fmt.Errorf("%w: the body can't be over %d bytes", ErrRequestTooLarge, maxBodySize)
+	}
 	if err != nil {
-		w.Write([]byte("Todo mal..."))
+		return fmt.Errorf("%w: %v", ErrBadRequest, err)
 	}
 
-	// Marshall to JSON
-	b, err := json.Marshal(user)
+	return nil
+}
+
+// writeJSON writes v as the JSON body of the response, with the given status
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	b, err := json.Marshal(v)
 	if err != nil {
-		w.Write([]byte("Todo mal..."))
+		WriteError(w, r, err)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	w.Write(b)
 }
 
-func (h *Handlers) GetAllUsers(w http.ResponseWriter, r *http.Request) {
-	userAccess, _ := strconv.Atoi(r.Header.Get("app-user-access-level")) // Check error!!!
+// knownCategories returns the ids of the existing categories, to validate the ones of a payload
+func (h *Handlers) knownCategories(r *http.Request) (map[int]bool, error) {
+	categories, err := h.db.GetAllCategories(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[int]bool, len(categories))
+	for _, category := range categories {
+		known[category.Id] = true
+	}
+
+	return known, nil
+}
+
+// pathID returns the numeric path variable with the given name
+func pathID(r *http.Request, name string) (int, error) {
+	id, err := strconv.Atoi(mux.Vars(r)[name])
+	if err != nil {
+		return 0, &ValidationError{Field: name, Message: "must be a valid id"}
+	}
+
+	return id, nil
+}
 
-	if userAccess == UserAccessLevel {
-		w.WriteHeader(http.StatusUnauthorized)
+// bearerToken returns the token of the Authorization header, failing with ErrUnauthorized if it is missing
+// or isn't a Bearer token
+func bearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", fmt.Errorf("%w: missing Authorization header", ErrUnauthorized)
+	}
+
+	scheme, token, ok := strings.Cut(strings.TrimSpace(header), " ")
+	token = strings.TrimSpace(token)
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" || strings.ContainsAny(token, " \t") {
+		return "", fmt.Errorf("%w: malformed Authorization header, expected \"Bearer <token>\"", ErrUnauthorized)
+	}
+
+	return token, nil
+}
+
+func (h *Handlers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("Hello theme park world :)"))
+}
+
+func (h *Handlers) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := pathID(r, "id")
+	if err != nil {
+		WriteError(w, r, err)
 		return
 	}
 
-	users, err := h.db.GetAllUsers()
+	err = requireSelfOrAdmin(r, userID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		WriteError(w, r, err)
+		return
 	}
 
-	b, err := json.Marshal(users)
+	h.writeUser(w, r, userID)
+}
+
+// GetMe returns the user of the request
+func (h *Handlers) GetMe(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+
+	h.writeUser(w, r, user.ID)
+}
+
+func (h *Handlers) writeUser(w http.ResponseWriter, r *http.Request, userID int) {
+	user, err := h.db.GetUser(r.Context(), userID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	// Marshall to JSON
+	b, err := json.Marshal(user)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		WriteError(w, r, err)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(b)
 }
 
-func (h *Handlers) SignIn(w http.ResponseWriter, r *http.Request) {
-	var userLogin UserLogin
-	err := json.NewDecoder(r.Body).Decode(&userLogin)
+// SetUserRole changes the access level of a user, recording which admin did it, and revokes their signed
+// access tokens
+func (h *Handlers) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := pathID(r, "id")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		WriteError(w, r, err)
 		return
 	}
 
-	token, userId, err := h.db.SignIn(userLogin.Email, userLogin.Password)
+	var roleRequest RoleRequest
+	err = decodeJSON(r, &roleRequest)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		WriteError(w, r, err)
 		return
 	}
 
-	tokenResponse := Token{userId, token}
-	tokenJSON, err := json.Marshal(tokenResponse)
+	if !slices.Contains(AnyRole, roleRequest.AccessLevel) {
+		WriteError(w, r, &ValidationError{Field: "access_level", Message: "must be a valid access level"})
+		return
+	}
+
+	// An admin demoting itself could leave the app without admins
+	admin, _ := UserFromContext(r.Context())
+	if admin.ID == userID {
+		WriteError(w, r, fmt.Errorf("%w: admins can't change their own role", ErrForbidden))
+		return
+	}
+
+	err = h.db.SetUserAccessLevel(r.Context(), userID, roleRequest.AccessLevel, admin.ID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
+	h.refreshTokenVersions(r)
 
-	w.Write(tokenJSON)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *Handlers) AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		reqToken := r.Header.Get("Authorization")
-		splitToken := strings.Split(reqToken, "Bearer ")
-		reqToken = splitToken[1]
-
-		isLoggedIn, userId, accessLevel := h.db.IsLoggedIn(reqToken)
-		if isLoggedIn {
-			r.Header.Set("app-user-id", strconv.Itoa(userId))
-			r.Header.Set("app-user-access-level", strconv.Itoa(accessLevel))
-			next.ServeHTTP(w, r)
-		} else {
-			w.WriteHeader(http.StatusUnauthorized)
-		}
-	})
-}
+// GetRoleChanges returns the audit of the access level changes of a user
+func (h *Handlers) GetRoleChanges(w http.ResponseWriter, r *http.Request) {
+	userID, err := pathID(r, "id")
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
 
-func (h *Handlers) GetCategories(w http.ResponseWriter, r *http.Request) {
-	categories, err := h.db.GetAllCategories()
+	roleChanges, err := h.db.GetRoleChanges(r.Context(), userID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
-	categoriesJson, err := json.Marshal(categories)
+	b, err := json.Marshal(roleChanges)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Write(categoriesJson)
+	w.Write(b)
 }
 
-func (h *Handlers) AddCategory(w http.ResponseWriter, r *http.Request) {
-	userAccess, _ := strconv.Atoi(r.Header.Get("app-user-access-level")) // Check error!!!
+func (h *Handlers) GetAllUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.db.GetAllUsers(r.Context())
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
 
-	if userAccess == UserAccessLevel {
-		w.WriteHeader(http.StatusUnauthorized)
+	b, err := json.Marshal(users)
+	if err != nil {
+		WriteError(w, r, err)
 		return
 	}
 
-	var category Category
-	err := json.NewDecoder(r.Body).Decode(&category)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func (h *Handlers) SignIn(w http.ResponseWriter, r *http.Request) {
+	var userLogin UserLogin
+	err := decodeJSON(r, &userLogin)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	userLogin.Email = normalizeEmail(userLogin.Email)
+
+	// Failed logins are counted per account and per IP, so guessing the password of one account and trying
+	// one password on many accounts are both slowed down
+	accountKey := accountLoginKey(userLogin.Email)
+	ipKey := ipLoginKey(clientIP(r, h.clientIPHeader))
+
+	lockedUntil, err := h.db.LoginLockedUntil(r.Context(), accountKey, ipKey)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		WriteError(w, r, err)
+		return
+	}
+	if wait := time.Until(lockedUntil); wait > 0 {
+		writeLoginLocked(w, r, wait)
 		return
 	}
 
-	err = h.db.AddCategory(category.Name)
+	session, err := h.db.SignIn(r.Context(), userLogin.Email, userLogin.Password, h.sessionTTL())
+	if errors.Is(err, ErrUnauthorized) {
+		for key, throttle := range map[string]LoginThrottle{accountKey: DefaultAccountThrottle, ipKey: DefaultIPThrottle} {
+			if _, err := h.db.RecordLoginFailure(r.Context(), key, throttle); err != nil {
+				log.Printf("Recording login failure of %s: %v", key, err)
+			}
+		}
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	if err := h.db.ResetLoginFailures(r.Context(), accountKey); err != nil {
+		log.Printf("Resetting login failures of %s: %v", accountKey, err)
+	}
+
+	h.writeToken(w, r, session)
 }
 
-func (h *Handlers) AddUser(w http.ResponseWriter, r *http.Request) {
-	var user User
-	err := json.NewDecoder(r.Body).Decode(&user)
+// writeLoginLocked answers a login while the account or IP is locked. It doesn't say which one, nor whether
+// the account exists.
+func writeLoginLocked(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	WriteError(w, r, fmt.Errorf("%w: too many failed logins, try again later", ErrTooManyRequests))
+}
+
+// RefreshToken rotates a refresh token, returning new tokens. The old refresh token can't be used again.
+func (h *Handlers) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var refreshRequest RefreshRequest
+	err := decodeJSON(r, &refreshRequest)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		WriteError(w, r, err)
 		return
 	}
 
-	err = h.db.AddUser(user)
+	session, err := h.db.RefreshSession(r.Context(), refreshRequest.RefreshToken, h.sessionTTL())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	h.writeToken(w, r, session)
 }
 
-func (h *Handlers) UpdateUser(w http.ResponseWriter, r *http.Request) {
-	var user User
-	err := json.NewDecoder(r.Body).Decode(&user)
+// sessionTTL returns the validity of the tokens the store has to create. Signed access tokens aren't stored.
+func (h *Handlers) sessionTTL() SessionTTL {
+	if h.signer != nil {
+		return SessionTTL{Refresh: h.refreshTokenTTL}
+	}
+
+	return SessionTTL{Access: h.tokenTTL, Refresh: h.refreshTokenTTL}
+}
+
+// writeToken writes the tokens of the session, signing an access token with the current access level
+// of the user if there is a signer
+func (h *Handlers) writeToken(w http.ResponseWriter, r *http.Request, session Session) {
+	tokenResponse := Token{
+		UserId:           session.UserID,
+		AccessToken:      session.AccessToken,
+		ExpiresIn:        int(h.tokenTTL.Seconds()),
+		RefreshToken:     session.RefreshToken,
+		RefreshExpiresIn: int(h.refreshTokenTTL.Seconds()),
+	}
+
+	if h.signer != nil {
+		// The version is read first, so a revocation in between rejects the token instead of being missed
+		version, err := h.db.GetTokenVersion(r.Context(), session.UserID)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+
+		user, err := h.db.GetUser(r.Context(), session.UserID)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+
+		tokenResponse.AccessToken, err = h.signer.Sign(session.UserID, user.AccessLevel, version, h.accessTokenTTL)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		tokenResponse.ExpiresIn = int(h.accessTokenTTL.Seconds())
+	}
+
+	tokenJSON, err := json.Marshal(tokenResponse)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		WriteError(w, r, err)
 		return
 	}
 
-	vars := mux.Vars(r)
-	userID, _ := strconv.Atoi(vars["id"]) // Check error!!!
-	user.ID = userID
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(tokenJSON)
+}
+
+// AuthMiddleware authenticates the bearer token of the request and puts the user in the request context,
+// see UserFromContext. Requests without a valid token get a 401 with a WWW-Authenticate header.
+func (h *Handlers) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqToken, err := bearerToken(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="themepark"`)
+			WriteError(w, r, err)
+			return
+		}
+
+		var user AuthUser
+		if h.signer != nil {
+			// Signed access tokens are checked without going to the database, against the revoked token versions
+			// refreshed in the background
+			var version int
+			user.ID, user.AccessLevel, version, err = h.signer.Verify(reqToken)
+			if err == nil && h.versions != nil && h.versions.Revoked(user.ID, version) {
+				err = fmt.Errorf("%w: access token revoked", ErrUnauthorized)
+			}
+		} else {
+			var isLoggedIn bool
+			isLoggedIn, user.ID, user.AccessLevel = h.db.IsLoggedIn(r.Context(), reqToken)
+			if !isLoggedIn {
+				err = fmt.Errorf("%w: invalid token", ErrUnauthorized)
+			}
+		}
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="themepark", error="invalid_token"`)
+			WriteError(w, r, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(contextWithUser(r.Context(), user)))
+	})
+}
+
+// Logout deletes the session of the token of the request. Signed access tokens aren't stored, so with them
+// it deletes the session of the refresh token of the body instead, and the access token stays valid until it
+// expires; LogoutAll revokes them too. A refresh token of another user is a 404, so users can only end their
+// own sessions.
+func (h *Handlers) Logout(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
 
-	err = h.db.UpdateUser(user)
+	token, err := bearerToken(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-}
+	if h.signer != nil {
+		var refreshRequest RefreshRequest
+		err = decodeJSON(r, &refreshRequest)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		token = refreshRequest.RefreshToken
+	}
 
-func (h *Handlers) GetParks(w http.ResponseWriter, r *http.Request) {
-	themeparks, err := h.db.GetAllThemeParks()
+	err = h.db.DeleteSession(r.Context(), user.ID, token)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
-	themeparksJson, err := json.Marshal(themeparks)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAll deletes every token of the user of the request, logging them out of all their sessions, and
+// revokes their signed access tokens
+func (h *Handlers) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	user, _ := UserFromContext(r.Context())
+
+	err := h.db.DeleteUserTokens(r.Context(), user.ID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
+	h.refreshTokenVersions(r)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(themeparksJson)
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *Handlers) GetParkDetails(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	themeparkId, _ := strconv.Atoi(vars["id"]) // Check error!!!
+// refreshTokenVersions reloads the revoked token versions after a revocation, so this server rejects the
+// revoked access tokens straight away instead of on the next background refresh
+func (h *Handlers) refreshTokenVersions(r *http.Request) {
+	if h.versions == nil {
+		return
+	}
+
+	if err := h.versions.Refresh(r.Context()); err != nil {
+		log.Printf("Error refreshing token versions (request %s): %v", RequestIDFromContext(r.Context()), err)
+	}
+}
 
-	themepark, err := h.db.GetThemeParkDetail(themeparkId)
+func (h *Handlers) GetCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := h.db.GetAllCategories(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
-	themeparkDetailJson, err := json.Marshal(themepark)
+	categoriesJson, err := json.Marshal(categories)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Write(themeparkDetailJson)
-	w.WriteHeader(http.StatusOK)
+	w.Write(categoriesJson)
 }
 
-func (h *Handlers) InsertParkComment(w http.ResponseWriter, r *http.Request) {
-	// Get user id
-	userId, _ := strconv.Atoi(r.Header.Get("app-user-id")) // Check error!!!
+func (h *Handlers) AddCategory(w http.ResponseWriter, r *http.Request) {
+	var category Category
+	err := decodeJSON(r, &category)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
 
-	// Get comment from json
-	var comment Comment
-	err := json.NewDecoder(r.Body).Decode(&comment)
+	err = validateCategory(category)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		WriteError(w, r, err)
 		return
 	}
 
-	err = h.db.InsertParkComment(comment.ThemeparkId, userId, comment.Comment)
+	err = h.db.AddCategory(r.Context(), category.Name)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(http.StatusCreated)
 }
 
-func (h *Handlers) InsertThemePark(w http.ResponseWriter, r *http.Request) {
-	// Get user id
-	userAccess, _ := strconv.Atoi(r.Header.Get("app-user-access-level")) // Check error!!!
-
-	if userAccess == UserAccessLevel {
-		w.WriteHeader(http.StatusUnauthorized)
+func (h *Handlers) AddUser(w http.ResponseWriter, r *http.Request) {
+	var user User
+	err := decodeJSON(r, &user)
+	if err != nil {
+		WriteError(w, r, err)
 		return
 	}
+	user.Email = normalizeEmail(user.Email)
 
-	// Get themePark from json
-	var themePark ThemePark
-	err := json.NewDecoder(r.Body).Decode(&themePark)
+	knownCategories, err := h.knownCategories(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	err = validateUser(user, true, knownCategories)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		WriteError(w, r, err)
 		return
 	}
 
-	// Insert theme park
-	err = h.db.AddThemePark(themePark)
+	err = h.db.AddUser(r.Context(), user)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		WriteError(w, r, err)
 		return
 	}
 
+	// The user is created anyway, and can ask for the email again
+	err = h.sendEmailVerification(r, user.Email)
+	if err != nil {
+		log.Printf("Error sending the email verification to %s (request %s): %v", user.Email, RequestIDFromContext(r.Context()), err)
+	}
+
 	w.WriteHeader(http.StatusCreated)
 }
 
-func (h *Handlers) DeleteThemePark(w http.ResponseWriter, r *http.Request) {
-	// Get user id
-	userAccess, _ := strconv.Atoi(r.Header.Get("app-user-access-level")) // Check error!!!
+// ResendEmailVerification sends the email verification link again. It answers the same whether the email
+// exists or not, so it can't be used to find out who is registered.
+func (h *Handlers) ResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	var userLogin UserLogin
+	err := decodeJSON(r, &userLogin)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	userLogin.Email = normalizeEmail(userLogin.Email)
 
-	if userAccess == UserAccessLevel {
-		w.WriteHeader(http.StatusUnauthorized)
+	sent, err := h.db.CountUserTokens(r.Context(), userLogin.Email, UserTokenVerifyEmail, time.Now().Add(-time.Hour))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if sent >= maxMailsPerHour {
+		w.Header().Set("Retry-After", "3600")
+		WriteError(w, r, fmt.Errorf("%w: too many verification emails, try again later", ErrTooManyRequests))
 		return
 	}
 
-	vars := mux.Vars(r)
-	themeParkId, _ := strconv.Atoi(vars["id"]) // Check error!!!
+	err = h.sendEmailVerification(r, userLogin.Email)
+	if err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrConflict) {
+		WriteError(w, r, err)
+		return
+	}
 
-	// Delete theme park
-	err := h.db.DeleteThemePark(themeParkId)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// VerifyEmail verifies the email of the user of the one-time token in the link sent by email
+func (h *Handlers) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	err := h.db.VerifyEmail(r.Context(), r.URL.Query().Get("token"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		WriteError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusAccepted)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("Email verified, you can log in now"))
 }
 
-func (h *Handlers) UpdateThemePark(w http.ResponseWriter, r *http.Request) {
-	// Get user id
-	userAccess, _ := strconv.Atoi(r.Header.Get("app-user-access-level")) // Check error!!!
+// ChangePassword sets a new password for the user of the request, checking the current one first.
+// All the sessions of the user are deleted and their signed access tokens revoked, so they have to log in again.
+// A wrong current password counts as a failed login of the account, so a stolen session can't be used to guess
+// the password.
+func (h *Handlers) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var passwordChange PasswordChange
+	err := decodeJSON(r, &passwordChange)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
 
-	if userAccess == UserAccessLevel {
-		w.WriteHeader(http.StatusUnauthorized)
+	err = validatePassword("new_password", passwordChange.NewPassword)
+	if err != nil {
+		WriteError(w, r, err)
 		return
 	}
 
-	vars := mux.Vars(r)
-	themeParkId, _ := strconv.Atoi(vars["id"]) // Check error!!!
+	authUser, _ := UserFromContext(r.Context())
+	user, err := h.db.GetUser(r.Context(), authUser.ID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
 
-	// Get themePark from json
-	var themePark ThemePark
-	err := json.NewDecoder(r.Body).Decode(&themePark)
+	accountKey := accountLoginKey(user.Email)
+	lockedUntil, err := h.db.LoginLockedUntil(r.Context(), accountKey)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		WriteError(w, r, err)
+		return
+	}
+	if wait := time.Until(lockedUntil); wait > 0 {
+		writeLoginLocked(w, r, wait)
 		return
 	}
 
-	// Set id to themepark struct
-	themePark.Id = themeParkId
+	err = h.db.ChangePassword(r.Context(), user.ID, passwordChange.CurrentPassword, passwordChange.NewPassword)
+	if errors.Is(err, ErrUnauthorized) {
+		if _, err := h.db.RecordLoginFailure(r.Context(), accountKey, DefaultAccountThrottle); err != nil {
+			log.Printf("Recording login failure of %s: %v", accountKey, err)
+		}
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	h.refreshTokenVersions(r)
+
+	if err := h.db.ResetLoginFailures(r.Context(), accountKey); err != nil {
+		log.Printf("Resetting login failures of %s: %v", accountKey, err)
+	}
 
-	err = h.db.UpdateThemePark(themePark)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ForgotPassword mails a one-time token to reset the password. It answers the same whether the email
+// exists or not, so it can't be used to find out who is registered.
+func (h *Handlers) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var userLogin UserLogin
+	err := decodeJSON(r, &userLogin)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		WriteError(w, r, err)
 		return
 	}
+	userLogin.Email = normalizeEmail(userLogin.Email)
 
-	w.WriteHeader(http.StatusAccepted)
+	sent, err := h.db.CountUserTokens(r.Context(), userLogin.Email, UserTokenResetPassword, time.Now().Add(-time.Hour))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if sent >= maxMailsPerHour {
+		w.Header().Set("Retry-After", "3600")
+		WriteError(w, r, fmt.Errorf("%w: too many password reset emails, try again later", ErrTooManyRequests))
+		return
+	}
+
+	token, err := h.db.CreatePasswordReset(r.Context(), userLogin.Email, passwordResetTTL)
+	if errors.Is(err, ErrNotFound) {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	err = h.mailer.Send(r.Context(), Mail{
+		To:      userLogin.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your account. If it was you, use this code to choose a new password:\n\n%s\n\n"+
+			"It can be used once and expires in %d minutes. If it wasn't you, you can ignore this email.\n", token, int(passwordResetTTL.Minutes())),
+	})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword sets a new password with the token mailed by ForgotPassword, deleting all the sessions of the user
+// and revoking their signed access tokens
+func (h *Handlers) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var passwordReset PasswordReset
+	err := decodeJSON(r, &passwordReset)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	err = validatePassword("new_password", passwordReset.NewPassword)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	err = h.db.ResetPassword(r.Context(), passwordReset.Token, passwordReset.NewPassword)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	h.refreshTokenVersions(r)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sendEmailVerification mails a new email verification link to a user pending verification
+func (h *Handlers) sendEmailVerification(r *http.Request, email string) error {
+	token, err := h.db.CreateEmailVerification(r.Context(), email, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := h.publicURL + "/pub/verify-email?token=" + url.QueryEscape(token)
+	return h.mailer.Send(r.Context(), Mail{
+		To:      email,
+		Subject: "Verify your email",
+		Body:    fmt.Sprintf("Open this link to verify your email and start using your account:\n\n%s\n\nThe link expires in %d hours.\n", link, int(emailVerificationTTL.Hours())),
+	})
+}
+
+func (h *Handlers) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	var user User
+	err := decodeJSON(r, &user)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	userID, err := pathID(r, "id")
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	user.ID = userID
+
+	err = requireSelfOrAdmin(r, userID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	knownCategories, err := h.knownCategories(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	err = validateUser(user, false, knownCategories)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	err = h.db.UpdateUser(r.Context(), user)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handlers) GetParks(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseParkFilter(r.URL.Query())
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	themeparks, err := h.db.GetAllThemeParks(r.Context(), filter)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	themeparksJson, err := json.Marshal(themeparks)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(themeparksJson)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handlers) GetParkDetails(w http.ResponseWriter, r *http.Request) {
+	themeparkId, err := pathID(r, "id")
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	filter, err := parseAttractionFilter(r.URL.Query())
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	themepark, err := h.db.GetThemeParkDetail(r.Context(), themeparkId, filter)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	themeparkDetailJson, err := json.Marshal(themepark)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(themeparkDetailJson)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handlers) InsertParkComment(w http.ResponseWriter, r *http.Request) {
+	// Get user id
+	user, _ := UserFromContext(r.Context())
+
+	// Get comment from json
+	var comment Comment
+	err := decodeJSON(r, &comment)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	err = validateComment(comment)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	err = h.db.InsertParkComment(r.Context(), comment.ThemeparkId, user.ID, comment.Comment)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handlers) InsertThemePark(w http.ResponseWriter, r *http.Request) {
+	// Get themePark from json
+	var themePark ThemePark
+	err := decodeJSON(r, &themePark)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	knownCategories, err := h.knownCategories(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	err = validateThemePark(themePark, knownCategories)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	// Insert theme park
+	err = h.db.AddThemePark(r.Context(), themePark)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *Handlers) DeleteThemePark(w http.ResponseWriter, r *http.Request) {
+	themeParkId, err := pathID(r, "id")
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	// Delete theme park
+	err = h.db.DeleteThemePark(r.Context(), themeParkId)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handlers) UpdateThemePark(w http.ResponseWriter, r *http.Request) {
+	themeParkId, err := pathID(r, "id")
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	// Get themePark from json
+	var themePark ThemePark
+	err = decodeJSON(r, &themePark)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	// Set id to themepark struct
+	themePark.Id = themeParkId
+
+	knownCategories, err := h.knownCategories(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	err = validateThemePark(themePark, knownCategories)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	err = h.db.UpdateThemePark(r.Context(), themePark)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handlers) GetParkAttractions(w http.ResponseWriter, r *http.Request) {
+	themeParkId, err := pathID(r, "id")
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	filter, err := parseAttractionFilter(r.URL.Query())
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	attractions, err := h.db.GetParkAttractions(r.Context(), themeParkId, filter)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, attractions)
+}
+
+func (h *Handlers) GetAttraction(w http.ResponseWriter, r *http.Request) {
+	themeParkId, attractionId, err := attractionPath(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	attraction, err := h.db.GetAttraction(r.Context(), themeParkId, attractionId)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, attraction)
+}
+
+// AddAttraction adds an attraction to the park of the path, returning it
+func (h *Handlers) AddAttraction(w http.ResponseWriter, r *http.Request) {
+	themeParkId, err := pathID(r, "id")
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	var attraction Attraction
+	err = decodeJSON(r, &attraction)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	attraction = attraction.withDefaults()
+	err = validateAttraction(attraction, themeParkId)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	attraction.ThemeparkId = themeParkId
+
+	attractionId, err := h.db.AddAttraction(r.Context(), attraction)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	created, err := h.db.GetAttraction(r.Context(), themeParkId, attractionId)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/priv/park/%d/attractions/%d", themeParkId, attractionId))
+	writeJSON(w, r, http.StatusCreated, created)
+}
+
+// UpdateAttraction replaces an attraction of the park of the path, returning it
+func (h *Handlers) UpdateAttraction(w http.ResponseWriter, r *http.Request) {
+	themeParkId, attractionId, err := attractionPath(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	var attraction Attraction
+	err = decodeJSON(r, &attraction)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	attraction = attraction.withDefaults()
+	err = validateAttraction(attraction, themeParkId)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	attraction.Id = attractionId
+	attraction.ThemeparkId = themeParkId
+
+	err = h.db.UpdateAttraction(r.Context(), attraction)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	updated, err := h.db.GetAttraction(r.Context(), themeParkId, attractionId)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, updated)
+}
+
+func (h *Handlers) DeleteAttraction(w http.ResponseWriter, r *http.Request) {
+	themeParkId, attractionId, err := attractionPath(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	err = h.db.DeleteAttraction(r.Context(), themeParkId, attractionId)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReportWaitTime records the current wait time of an attraction reported by the user
+func (h *Handlers) ReportWaitTime(w http.ResponseWriter, r *http.Request) {
+	themeParkId, attractionId, err := attractionPath(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	var waitTime WaitTimeRequest
+	err = decodeJSON(r, &waitTime)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	err = validateWaitTime(waitTime)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	user, _ := UserFromContext(r.Context())
+	err = h.db.AddWaitTimeReport(r.Context(), themeParkId, WaitTimeReport{
+		AttractionId: attractionId,
+		UserId:       user.ID,
+		WaitMinutes:  *waitTime.WaitMinutes,
+	})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// GetWaitTimes returns the current estimate and the history of the wait times of an attraction
+func (h *Handlers) GetWaitTimes(w http.ResponseWriter, r *http.Request) {
+	themeParkId, attractionId, err := attractionPath(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	waitTimes, err := h.db.GetWaitTimes(r.Context(), themeParkId, attractionId)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if waitTimes == nil {
+		waitTimes = &WaitTimes{}
+	}
+
+	writeJSON(w, r, http.StatusOK, waitTimes)
+}
+
+// attractionPath returns the park and attraction ids of /park/{id}/attractions/{attractionId}
+func attractionPath(r *http.Request) (int, int, error) {
+	themeParkId, err := pathID(r, "id")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	attractionId, err := pathID(r, "attractionId")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return themeParkId, attractionId, nil
+}
+
+// GetParkTicketPrices lists all the ticket prices of a park, also the past and future ones
+func (h *Handlers) GetParkTicketPrices(w http.ResponseWriter, r *http.Request) {
+	themeParkId, err := pathID(r, "id")
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	prices, err := h.db.GetParkTicketPrices(r.Context(), themeParkId)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, prices)
+}
+
+func (h *Handlers) GetTicketPrice(w http.ResponseWriter, r *http.Request) {
+	themeParkId, priceId, err := ticketPricePath(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	price, err := h.db.GetTicketPrice(r.Context(), themeParkId, priceId)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, price)
+}
+
+// AddTicketPrice adds a ticket price to the park of the path, returning it
+func (h *Handlers) AddTicketPrice(w http.ResponseWriter, r *http.Request) {
+	themeParkId, err := pathID(r, "id")
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	var price TicketPrice
+	err = decodeJSON(r, &price)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	price.Currency = strings.ToUpper(price.Currency)
+	err = validateTicketPrice(price, themeParkId)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	price.ThemeparkId = themeParkId
+
+	priceId, err := h.db.AddTicketPrice(r.Context(), price)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	created, err := h.db.GetTicketPrice(r.Context(), themeParkId, priceId)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/priv/park/%d/prices/%d", themeParkId, priceId))
+	writeJSON(w, r, http.StatusCreated, created)
+}
+
+// UpdateTicketPrice replaces a ticket price of the park of the path, returning it
+func (h *Handlers) UpdateTicketPrice(w http.ResponseWriter, r *http.Request) {
+	themeParkId, priceId, err := ticketPricePath(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	var price TicketPrice
+	err = decodeJSON(r, &price)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	price.Currency = strings.ToUpper(price.Currency)
+	err = validateTicketPrice(price, themeParkId)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	price.Id = priceId
+	price.ThemeparkId = themeParkId
+
+	err = h.db.UpdateTicketPrice(r.Context(), price)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	updated, err := h.db.GetTicketPrice(r.Context(), themeParkId, priceId)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, updated)
+}
+
+func (h *Handlers) DeleteTicketPrice(w http.ResponseWriter, r *http.Request) {
+	themeParkId, priceId, err := ticketPricePath(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	err = h.db.DeleteTicketPrice(r.Context(), themeParkId, priceId)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ticketPricePath returns the park and ticket price ids of the path
+func ticketPricePath(r *http.Request) (int, int, error) {
+	themeParkId, err := pathID(r, "id")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	priceId, err := pathID(r, "priceId")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return themeParkId, priceId, nil
+}
+
+func (h *Handlers) GetParkCalendar(w http.ResponseWriter, r *http.Request) {
+	themeParkId, err := pathID(r, "id")
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	calendar, err := h.db.GetParkCalendar(r.Context(), themeParkId)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, calendar)
+}
+
+// SetParkCalendar replaces the opening hours and time zone of a park, returning the new calendar
+func (h *Handlers) SetParkCalendar(w http.ResponseWriter, r *http.Request) {
+	themeParkId, err := pathID(r, "id")
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	var calendar ParkCalendar
+	err = decodeJSON(r, &calendar)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	err = validateCalendar(calendar)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	err = h.db.SetParkCalendar(r.Context(), themeParkId, calendar)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	h.GetParkCalendar(w, r)
+}
+
+// GetParkSchedule returns the opening hours of a park for every date between the from and to query parameters
+func (h *Handlers) GetParkSchedule(w http.ResponseWriter, r *http.Request) {
+	themeParkId, err := pathID(r, "id")
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	calendar, err := h.db.GetParkCalendar(r.Context(), themeParkId)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	from, to, err := parseDateRange(r.URL.Query(), calendar.location(), scheduleDays)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, ParkSchedule{
+		ThemeparkId: themeParkId,
+		TimeZone:    calendar.TimeZone,
+		Days:        calendar.Schedule(from, to),
+	})
+}
+
+// GetParkOpen says whether a park is open at the instant of the at query parameter (RFC 3339), or now
+func (h *Handlers) GetParkOpen(w http.ResponseWriter, r *http.Request) {
+	themeParkId, err := pathID(r, "id")
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	at := time.Now()
+	if r.URL.Query().Has("at") {
+		at, err = time.Parse(time.RFC3339, r.URL.Query().Get("at"))
+		if err != nil {
+			WriteError(w, r, &ValidationError{Field: "at", Message: "must be a date and time as RFC 3339, e.g. 2024-07-01T18:30:00+02:00"})
+			return
+		}
+	}
+
+	calendar, err := h.db.GetParkCalendar(r.Context(), themeParkId)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, calendar.OpenAt(at))
+}
+
+// GetParkICS exports the opening hours of a park between the from and to query parameters as an iCalendar file
+func (h *Handlers) GetParkICS(w http.ResponseWriter, r *http.Request) {
+	themeParkId, err := pathID(r, "id")
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	calendar, err := h.db.GetParkCalendar(r.Context(), themeParkId)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	from, to, err := parseDateRange(r.URL.Query(), calendar.location(), icsDays)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="themepark-%d.ics"`, themeParkId))
+	w.Write(calendarICS(*calendar, calendar.Schedule(from, to), time.Now()))
+}
+
+// StatsReporter is implemented by stores that can report the statistics of their connection pool.
+type StatsReporter interface {
+	Stats() PoolStats
+}
+
+func (h *Handlers) GetDatabaseStats(w http.ResponseWriter, r *http.Request) {
+	reporter, ok := h.db.(StatsReporter)
+	if !ok {
+		WriteError(w, r, fmt.Errorf("database statistics: %w", ErrNotFound))
+		return
+	}
+
+	statsJson, err := json.Marshal(reporter.Stats())
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(statsJson)
 }
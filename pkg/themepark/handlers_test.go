@@ -0,0 +1,562 @@
+package themepark
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testServer is the router of the API over a MemoryStore with the test dataset
+type testServer struct {
+	t      *testing.T
+	store  *MemoryStore
+	router http.Handler
+}
+
+func newTestServer(t *testing.T, opts ...RouterOption) *testServer {
+	t.Helper()
+
+	store := NewMemoryStoreWithTestData()
+	return &testServer{t: t, store: store, router: NewRouter(store, opts...)}
+}
+
+// do sends a request with a JSON body, if any, and the access token, if any
+func (s *testServer) do(method string, path string, token string, body string) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// login logs the user in through the API, failing the test if it doesn't succeed
+func (s *testServer) login(email string, password string) Token {
+	s.t.Helper()
+
+	rec := s.do(http.MethodPost, "/pub/login", "", `{"email": "`+email+`", "password": "`+password+`"}`)
+	if rec.Code != http.StatusOK {
+		s.t.Fatalf("login of %s: status = %d: %s", email, rec.Code, rec.Body)
+	}
+
+	return decodeBody[Token](s.t, rec)
+}
+
+// decodeBody decodes the JSON body of a response
+func decodeBody[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+
+	return v
+}
+
+// recordingMailer keeps the emails instead of sending them
+type recordingMailer struct {
+	mails []Mail
+}
+
+func (m *recordingMailer) Send(ctx context.Context, mail Mail) error {
+	m.mails = append(m.mails, mail)
+	return nil
+}
+
+var mailedTokenRegexp = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+
+// mailedToken returns the one-time token of the last email sent, alone or in a link
+func (m *recordingMailer) mailedToken(t *testing.T) string {
+	t.Helper()
+
+	if len(m.mails) == 0 {
+		t.Fatal("no email sent")
+	}
+	token := mailedTokenRegexp.FindString(m.mails[len(m.mails)-1].Body)
+	if token == "" {
+		t.Fatalf("no token in the email: %q", m.mails[len(m.mails)-1].Body)
+	}
+
+	return token
+}
+
+func testSigner(t *testing.T) *TokenSigner {
+	t.Helper()
+
+	signer, err := NewTokenSigner("test:hs256:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer
+}
+
+func TestSignedAccessTokensRevoked(t *testing.T) {
+	signer := testSigner(t)
+
+	// Every step revokes the signed access tokens of the user issued before it
+	tests := []struct {
+		name     string
+		revoke   func(s *testServer, admin string, user string) *httptest.ResponseRecorder
+		password string // Of the user afterwards
+	}{
+		{"role change", func(s *testServer, admin string, user string) *httptest.ResponseRecorder {
+			return s.do(http.MethodPut, "/priv/users/2/role", admin, `{"access_level": 3}`)
+		}, "ocelote1234"},
+		{"password change", func(s *testServer, admin string, user string) *httptest.ResponseRecorder {
+			return s.do(http.MethodPost, "/priv/me/password", user, `{"current_password": "ocelote1234", "new_password": "ocelote12345"}`)
+		}, "ocelote12345"},
+		{"password reset", func(s *testServer, admin string, user string) *httptest.ResponseRecorder {
+			token, err := s.store.CreatePasswordReset(context.Background(), "revolver.occelote@konami.jp", time.Hour)
+			if err != nil {
+				s.t.Fatal(err)
+			}
+			return s.do(http.MethodPost, "/pub/password/reset", "", `{"token": "`+token+`", "new_password": "ocelote12345"}`)
+		}, "ocelote12345"},
+		{"logout everywhere", func(s *testServer, admin string, user string) *httptest.ResponseRecorder {
+			return s.do(http.MethodPost, "/priv/logout/all", user, "")
+		}, "ocelote1234"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			versions := NewTokenVersions(s.store, DefaultAccessTokenTTL)
+			s.router = NewRouter(s.store, WithTokenSigner(signer), WithTokenVersions(versions))
+
+			// Another server over the same database, which only learns about revocations when refreshed
+			otherVersions := NewTokenVersions(s.store, DefaultAccessTokenTTL)
+			other := &testServer{t: t, store: s.store, router: NewRouter(s.store, WithTokenSigner(signer), WithTokenVersions(otherVersions))}
+
+			admin := s.login("admin@parkfinder.com", "snake1234").AccessToken
+			user := s.login("revolver.occelote@konami.jp", "ocelote1234").AccessToken
+
+			if rec := tt.revoke(s, admin, user); rec.Code >= 300 {
+				t.Fatalf("%s: status = %d: %s", tt.name, rec.Code, rec.Body)
+			}
+			if rec := s.do(http.MethodGet, "/priv/parks", user, ""); rec.Code != http.StatusUnauthorized {
+				t.Errorf("status after = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+			if rec := s.do(http.MethodGet, "/priv/parks", admin, ""); rec.Code != http.StatusOK {
+				t.Errorf("status of the other user = %d, want %d", rec.Code, http.StatusOK)
+			}
+
+			if rec := other.do(http.MethodGet, "/priv/parks", user, ""); rec.Code != http.StatusOK {
+				t.Errorf("status on the other server before refreshing = %d, want %d", rec.Code, http.StatusOK)
+			}
+			if err := otherVersions.Refresh(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if rec := other.do(http.MethodGet, "/priv/parks", user, ""); rec.Code != http.StatusUnauthorized {
+				t.Errorf("status on the other server after refreshing = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+
+			// Tokens signed afterwards carry the new version
+			user = s.login("revolver.occelote@konami.jp", tt.password).AccessToken
+			if rec := other.do(http.MethodGet, "/priv/parks", user, ""); rec.Code != http.StatusOK {
+				t.Errorf("status of a new token = %d, want %d", rec.Code, http.StatusOK)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	s := newTestServer(t)
+	first := s.login("admin@parkfinder.com", "snake1234")
+
+	rec := s.do(http.MethodPost, "/pub/token/refresh", "", `{"refresh_token": "`+first.RefreshToken+`"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh status = %d: %s", rec.Code, rec.Body)
+	}
+	second := decodeBody[Token](t, rec)
+
+	// Using the first refresh token again revokes the whole session, with the tokens rotated from it
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+	}{
+		{"reused refresh token", http.MethodPost, "/pub/token/refresh", "", `{"refresh_token": "` + first.RefreshToken + `"}`},
+		{"rotated refresh token", http.MethodPost, "/pub/token/refresh", "", `{"refresh_token": "` + second.RefreshToken + `"}`},
+		{"rotated access token", http.MethodGet, "/priv/parks", second.AccessToken, ""},
+	}
+	for _, step := range steps {
+		rec := s.do(step.method, step.path, step.token, step.body)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want %d", step.name, rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestLogoutOnlyOwnSessions(t *testing.T) {
+	s := newTestServer(t, WithTokenSigner(testSigner(t)))
+	admin := s.login("admin@parkfinder.com", "snake1234")
+	user := s.login("revolver.occelote@konami.jp", "ocelote1234")
+
+	// With signed access tokens the session comes from the body, so it could be anyone's
+	rec := s.do(http.MethodPost, "/priv/logout", user.AccessToken, `{"refresh_token": "`+admin.RefreshToken+`"}`)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("logout with the refresh token of another user: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	rec = s.do(http.MethodPost, "/pub/token/refresh", "", `{"refresh_token": "`+admin.RefreshToken+`"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("the session of the other user was deleted: refresh status = %d", rec.Code)
+	}
+
+	rec = s.do(http.MethodPost, "/priv/logout", user.AccessToken, `{"refresh_token": "`+user.RefreshToken+`"}`)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("logout status = %d: %s", rec.Code, rec.Body)
+	}
+	rec = s.do(http.MethodPost, "/pub/token/refresh", "", `{"refresh_token": "`+user.RefreshToken+`"}`)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("refresh after logout: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAuthMiddlewareRejectsMissingTokens(t *testing.T) {
+	s := newTestServer(t)
+
+	tests := []struct {
+		name          string
+		authorization string
+		authenticate  string
+	}{
+		{"no header", "", `Bearer realm="themepark"`},
+		{"other scheme", "Basic YWRtaW46c25ha2U=", `Bearer realm="themepark"`},
+		{"no token", "Bearer", `Bearer realm="themepark"`},
+		{"two tokens", "Bearer abc def", `Bearer realm="themepark"`},
+		{"unknown token", "Bearer 6f0f1a3e-62b5-4d4e-9c5e-0a4f3b8e2c11", `Bearer realm="themepark", error="invalid_token"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/priv/parks", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			s.router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got != tt.authenticate {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.authenticate)
+			}
+			if got := decodeBody[errorResponse](t, rec).Code; got != "unauthorized" {
+				t.Errorf("code = %q, want unauthorized", got)
+			}
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	s := newTestServer(t)
+
+	err := s.store.SetUserAccessLevel(context.Background(), 3, ModeratorAccessLevel, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin := s.login("admin@parkfinder.com", "snake1234").AccessToken
+	user := s.login("revolver.occelote@konami.jp", "ocelote1234").AccessToken
+	moderator := s.login("meryl.silverburgh@konami.jp", "meryl1234").AccessToken
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{"admin lists users", http.MethodGet, "/priv/users", admin, http.StatusOK},
+		{"user lists users", http.MethodGet, "/priv/users", user, http.StatusForbidden},
+		{"moderator lists users", http.MethodGet, "/priv/users", moderator, http.StatusForbidden},
+		{"anonymous lists users", http.MethodGet, "/priv/users", "", http.StatusUnauthorized},
+		{"user lists parks", http.MethodGet, "/priv/parks", user, http.StatusOK},
+		{"moderator deletes a park", http.MethodDelete, "/priv/park/1", moderator, http.StatusForbidden},
+		{"user deletes a park", http.MethodDelete, "/priv/park/1", user, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(tt.method, tt.path, tt.token, "")
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
+
+const newUserJSON = `{"name": "Laura", "email": "laura@prueba.com", "password": "prueba1234", "birth_date": "1991-02-18T00:00:00Z", "city": "Madrid", "categories": [1, 2], "profile_picture": "", "description": "Im a chill girl"}`
+
+func TestEmailVerification(t *testing.T) {
+	mailer := &recordingMailer{}
+	s := newTestServer(t, WithMailer(mailer), WithPublicURL("https://api.parkfinder.com/"))
+
+	if rec := s.do(http.MethodPost, "/pub/register", "", newUserJSON); rec.Code != http.StatusCreated {
+		t.Fatalf("register status = %d: %s", rec.Code, rec.Body)
+	}
+	if len(mailer.mails) != 1 || mailer.mails[0].To != "laura@prueba.com" {
+		t.Fatalf("mails = %+v, want one to laura@prueba.com", mailer.mails)
+	}
+	if !strings.Contains(mailer.mails[0].Body, "https://api.parkfinder.com/pub/verify-email?token=") {
+		t.Errorf("body = %q, want a link to the public URL", mailer.mails[0].Body)
+	}
+	token := mailer.mailedToken(t)
+
+	login := `{"email": "laura@prueba.com", "password": "prueba1234"}`
+	if rec := s.do(http.MethodPost, "/pub/login", "", login); rec.Code != http.StatusForbidden {
+		t.Errorf("login status before verifying = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	if rec := s.do(http.MethodGet, "/pub/verify-email?token="+token, "", ""); rec.Code != http.StatusOK {
+		t.Fatalf("verify status = %d: %s", rec.Code, rec.Body)
+	}
+	s.login("laura@prueba.com", "prueba1234")
+
+	// The token is single use, and verified emails don't get new ones
+	if rec := s.do(http.MethodGet, "/pub/verify-email?token="+token, "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("reused token status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := s.do(http.MethodPost, "/pub/register/resend", "", `{"email": "laura@prueba.com"}`); rec.Code != http.StatusAccepted {
+		t.Errorf("resend status = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+	if len(mailer.mails) != 1 {
+		t.Errorf("%d mails sent after verifying, want none", len(mailer.mails)-1)
+	}
+}
+
+func TestEmailVerificationExpired(t *testing.T) {
+	mailer := &recordingMailer{}
+	s := newTestServer(t, WithMailer(mailer))
+
+	if rec := s.do(http.MethodPost, "/pub/register", "", newUserJSON); rec.Code != http.StatusCreated {
+		t.Fatalf("register status = %d: %s", rec.Code, rec.Body)
+	}
+	expired := mailer.mailedToken(t)
+	stored := s.store.userTokens[hashToken(expired)]
+	stored.expires = time.Now().Add(-time.Minute)
+	s.store.userTokens[hashToken(expired)] = stored
+
+	if rec := s.do(http.MethodGet, "/pub/verify-email?token="+expired, "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expired token status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := s.do(http.MethodPost, "/pub/login", "", `{"email": "laura@prueba.com", "password": "prueba1234"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("login status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	// A new link works, and the resends are limited per hour
+	if rec := s.do(http.MethodPost, "/pub/register/resend", "", `{"email": "laura@prueba.com"}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("resend status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := s.do(http.MethodGet, "/pub/verify-email?token="+mailer.mailedToken(t), "", ""); rec.Code != http.StatusOK {
+		t.Errorf("new token status = %d: %s", rec.Code, rec.Body)
+	}
+	s.login("laura@prueba.com", "prueba1234")
+}
+
+func TestEmailVerificationResendLimit(t *testing.T) {
+	mailer := &recordingMailer{}
+	s := newTestServer(t, WithMailer(mailer))
+
+	if rec := s.do(http.MethodPost, "/pub/register", "", newUserJSON); rec.Code != http.StatusCreated {
+		t.Fatalf("register status = %d: %s", rec.Code, rec.Body)
+	}
+
+	for i := 1; i < maxMailsPerHour; i++ {
+		if rec := s.do(http.MethodPost, "/pub/register/resend", "", `{"email": "laura@prueba.com"}`); rec.Code != http.StatusAccepted {
+			t.Fatalf("resend %d status = %d: %s", i, rec.Code, rec.Body)
+		}
+	}
+	rec := s.do(http.MethodPost, "/pub/register/resend", "", `{"email": "laura@prueba.com"}`)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("status over the limit = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if len(mailer.mails) != maxMailsPerHour {
+		t.Errorf("%d mails sent, want %d", len(mailer.mails), maxMailsPerHour)
+	}
+
+	// Unknown emails answer the same, so they don't tell who is registered
+	if rec := s.do(http.MethodPost, "/pub/register/resend", "", `{"email": "nobody@prueba.com"}`); rec.Code != http.StatusAccepted {
+		t.Errorf("unknown email status = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	mailer := &recordingMailer{}
+	s := newTestServer(t, WithMailer(mailer))
+	ctx := context.Background()
+
+	first := s.login("revolver.occelote@konami.jp", "ocelote1234")
+	second := s.login("revolver.occelote@konami.jp", "ocelote1234")
+	version, err := s.store.GetTokenVersion(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := s.do(http.MethodPost, "/pub/password/forgot", "", `{"email": "revolver.occelote@konami.jp"}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("forgot status = %d: %s", rec.Code, rec.Body)
+	}
+	if len(mailer.mails) != 1 || mailer.mails[0].To != "revolver.occelote@konami.jp" {
+		t.Fatalf("mails = %+v, want one to revolver.occelote@konami.jp", mailer.mails)
+	}
+	token := mailer.mailedToken(t)
+
+	if rec := s.do(http.MethodPost, "/pub/password/reset", "", `{"token": "`+token+`", "new_password": "short"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("short password status = %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if rec := s.do(http.MethodPost, "/pub/password/reset", "", `{"token": "`+token+`", "new_password": "ocelote12345"}`); rec.Code != http.StatusNoContent {
+		t.Fatalf("reset status = %d: %s", rec.Code, rec.Body)
+	}
+
+	// Every session of the user is gone and their signed access tokens are revoked
+	for _, session := range []Token{first, second} {
+		if rec := s.do(http.MethodGet, "/priv/me", session.AccessToken, ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("access token status = %d, want %d", rec.Code, http.StatusUnauthorized)
+		}
+		if rec := s.do(http.MethodPost, "/pub/token/refresh", "", `{"refresh_token": "`+session.RefreshToken+`"}`); rec.Code != http.StatusUnauthorized {
+			t.Errorf("refresh token status = %d, want %d", rec.Code, http.StatusUnauthorized)
+		}
+	}
+	if got, err := s.store.GetTokenVersion(ctx, 2); err != nil || got != version+1 {
+		t.Errorf("token version = %d, %v, want %d", got, err, version+1)
+	}
+
+	if rec := s.do(http.MethodPost, "/pub/login", "", `{"email": "revolver.occelote@konami.jp", "password": "ocelote1234"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("login with the old password status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	s.login("revolver.occelote@konami.jp", "ocelote12345")
+
+	// The token is single use
+	if rec := s.do(http.MethodPost, "/pub/password/reset", "", `{"token": "`+token+`", "new_password": "ocelote123456"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("reused token status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestPasswordResetExpired(t *testing.T) {
+	s := newTestServer(t)
+
+	token, err := s.store.CreatePasswordReset(context.Background(), "revolver.occelote@konami.jp", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := s.do(http.MethodPost, "/pub/password/reset", "", `{"token": "`+token+`", "new_password": "ocelote12345"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("expired token status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	s.login("revolver.occelote@konami.jp", "ocelote1234")
+}
+
+func TestChangePasswordThrottled(t *testing.T) {
+	s := newTestServer(t)
+	user := s.login("revolver.occelote@konami.jp", "ocelote1234").AccessToken
+
+	// Wrong current passwords count as failed logins of the account
+	wrong := `{"current_password": "wrong1234", "new_password": "ocelote12345"}`
+	for i := 0; i <= DefaultAccountThrottle.FreeAttempts; i++ {
+		if rec := s.do(http.MethodPost, "/priv/me/password", user, wrong); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("failure %d: status = %d, want %d", i+1, rec.Code, http.StatusUnauthorized)
+		}
+	}
+
+	right := `{"current_password": "ocelote1234", "new_password": "ocelote12345"}`
+	if rec := s.do(http.MethodPost, "/priv/me/password", user, right); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("change password status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec := s.do(http.MethodPost, "/pub/login", "", `{"email": "revolver.occelote@konami.jp", "password": "ocelote1234"}`); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("login status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestPayloadErrors(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.login("admin@parkfinder.com", "snake1234").AccessToken
+
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		body   string
+		status int
+		code   string
+		fields []string // Of the details, in order
+	}{
+		{
+			name:   "invalid park",
+			path:   "/priv/parks",
+			token:  admin,
+			body:   `{"name": "", "picture": "", "latitude": 91, "longitude": 2, "categories": [{"id": 99}]}`,
+			status: http.StatusUnprocessableEntity,
+			code:   "validation_error",
+			fields: []string{"name", "latitude", "categories[0]"},
+		},
+		{
+			name:   "invalid registration",
+			path:   "/pub/register",
+			body:   `{"name": "Laura", "email": "Laura <laura@prueba.com>", "password": "short", "birth_date": "2999-01-01T00:00:00Z", "city": "Madrid", "categories": [], "profile_picture": "", "description": ""}`,
+			status: http.StatusUnprocessableEntity,
+			code:   "validation_error",
+			fields: []string{"email", "password", "birth_date"},
+		},
+		{
+			name:   "unknown field",
+			path:   "/priv/categories",
+			token:  admin,
+			body:   `{"name": "Acuáticos", "colour": "blue"}`,
+			status: http.StatusBadRequest,
+			code:   "bad_request",
+		},
+		{
+			name:   "trailing data",
+			path:   "/priv/categories",
+			token:  admin,
+			body:   `{"name": "Acuáticos"} {"name": "Nocturnos"}`,
+			status: http.StatusBadRequest,
+			code:   "bad_request",
+		},
+		{
+			name:   "body too large",
+			path:   "/priv/categories",
+			token:  admin,
+			body:   `{"name": "` + strings.Repeat("a", maxBodySize) + `"}`,
+			status: http.StatusRequestEntityTooLarge,
+			code:   "request_too_large",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(http.MethodPost, tt.path, tt.token, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+
+			response := decodeBody[errorResponse](t, rec)
+			if response.Code != tt.code {
+				t.Errorf("code = %q, want %q", response.Code, tt.code)
+			}
+			var fields []string
+			for _, detail := range response.Details {
+				fields = append(fields, detail.Field)
+			}
+			if !slices.Equal(fields, tt.fields) {
+				t.Errorf("detail fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
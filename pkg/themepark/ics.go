@@ -0,0 +1,95 @@
+package themepark
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	icsTimeLayout = "20060102T150405Z"
+	icsDateLayout = "20060102"
+	icsLineLength = 75 // Octets, longer lines are folded
+)
+
+// calendarICS returns the schedule of a park as an iCalendar (RFC 5545) file, with an event for every opening
+// hours and an all day event for the closed days with a note, like a closure for Christmas
+func calendarICS(calendar ParkCalendar, days []DaySchedule, now time.Time) []byte {
+	location := calendar.location()
+
+	var b strings.Builder
+	writeICSLine(&b, "BEGIN:VCALENDAR")
+	writeICSLine(&b, "VERSION:2.0")
+	writeICSLine(&b, "PRODID:-//ParkFinder//Theme park calendar//EN")
+	writeICSLine(&b, "CALSCALE:GREGORIAN")
+	writeICSLine(&b, "X-WR-CALNAME:"+escapeICS(calendar.ThemeparkName))
+	writeICSLine(&b, "X-WR-TIMEZONE:"+calendar.TimeZone)
+
+	for _, day := range days {
+		uid := fmt.Sprintf("themepark-%d-%s", calendar.ThemeparkId, strings.ReplaceAll(day.Date, "-", ""))
+
+		if day.Closed {
+			if day.Note == "" {
+				continue
+			}
+			date, err := time.Parse(dateLayout, day.Date)
+			if err != nil {
+				continue
+			}
+
+			writeICSLine(&b, "BEGIN:VEVENT")
+			writeICSLine(&b, "UID:"+uid+"-closed@parkfinder.com")
+			writeICSLine(&b, "DTSTAMP:"+now.UTC().Format(icsTimeLayout))
+			writeICSLine(&b, "DTSTART;VALUE=DATE:"+date.Format(icsDateLayout))
+			writeICSLine(&b, "DTEND;VALUE=DATE:"+date.AddDate(0, 0, 1).Format(icsDateLayout))
+			writeICSLine(&b, "SUMMARY:"+escapeICS(calendar.ThemeparkName+" closed"))
+			writeICSLine(&b, "DESCRIPTION:"+escapeICS(day.Note))
+			writeICSLine(&b, "TRANSP:TRANSPARENT")
+			writeICSLine(&b, "END:VEVENT")
+			continue
+		}
+
+		for i, opening := range calendar.openings(day, location) {
+			writeICSLine(&b, "BEGIN:VEVENT")
+			writeICSLine(&b, fmt.Sprintf("UID:%s-%d@parkfinder.com", uid, i+1))
+			writeICSLine(&b, "DTSTAMP:"+now.UTC().Format(icsTimeLayout))
+			writeICSLine(&b, "DTSTART:"+opening.start.UTC().Format(icsTimeLayout))
+			writeICSLine(&b, "DTEND:"+opening.end.UTC().Format(icsTimeLayout))
+			writeICSLine(&b, "SUMMARY:"+escapeICS(calendar.ThemeparkName+" open"))
+			if day.Note != "" {
+				writeICSLine(&b, "DESCRIPTION:"+escapeICS(day.Note))
+			}
+			writeICSLine(&b, "TRANSP:TRANSPARENT")
+			writeICSLine(&b, "END:VEVENT")
+		}
+	}
+
+	writeICSLine(&b, "END:VCALENDAR")
+
+	return []byte(b.String())
+}
+
+// escapeICS escapes a text value
+func escapeICS(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(text)
+}
+
+// writeICSLine writes a content line ended with CRLF, folding it into lines of at most icsLineLength octets
+// without splitting a UTF-8 character
+func writeICSLine(b *strings.Builder, line string) {
+	limit := icsLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = icsLineLength - 1 // The leading space of the continuation lines counts
+	}
+
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,66 @@
+package themepark
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// LoginThrottle says how long logins are locked after failed attempts. The failures are counted by the store,
+// per key, so they are shared by every instance of the app and survive restarts.
+type LoginThrottle struct {
+	FreeAttempts int           // Failed attempts allowed before locking
+	BaseLock     time.Duration // Lock after the first failure over FreeAttempts, doubled on every further one
+	MaxLock      time.Duration
+	Window       time.Duration // Failures older than this are forgotten, at most a day
+}
+
+// Default throttles. IPs get more attempts, since many users can share one behind a NAT.
+var (
+	DefaultAccountThrottle = LoginThrottle{FreeAttempts: 5, BaseLock: 30 * time.Second, MaxLock: 15 * time.Minute, Window: time.Hour}
+	DefaultIPThrottle      = LoginThrottle{FreeAttempts: 20, BaseLock: 30 * time.Second, MaxLock: time.Hour, Window: time.Hour}
+)
+
+// lockFor returns how long to lock the logins after the given number of consecutive failures
+func (t LoginThrottle) lockFor(failures int) time.Duration {
+	over := failures - t.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+
+	lock := t.BaseLock
+	for i := 1; i < over && lock < t.MaxLock; i++ {
+		lock *= 2
+	}
+
+	return min(lock, t.MaxLock)
+}
+
+// accountLoginKey is the key of the login failures of an account. The account may not exist.
+func accountLoginKey(email string) string {
+	return "email:" + normalizeEmail(email)
+}
+
+// ipLoginKey is the key of the login failures of an IP
+func ipLoginKey(ip string) string {
+	return "ip:" + ip
+}
+
+// clientIP returns the IP of the client. With a header, it is the last address in it, which is the one
+// added by the proxy in front of the app; the ones before could come from the client.
+func clientIP(r *http.Request, header string) string {
+	if header != "" {
+		if value := r.Header.Get(header); value != "" {
+			addresses := strings.Split(value, ",")
+			return strings.TrimSpace(addresses[len(addresses)-1])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
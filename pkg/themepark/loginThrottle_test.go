@@ -0,0 +1,116 @@
+package themepark
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockFor(t *testing.T) {
+	throttle := LoginThrottle{FreeAttempts: 5, BaseLock: 30 * time.Second, MaxLock: 15 * time.Minute, Window: time.Hour}
+
+	tests := []struct {
+		failures int
+		lock     time.Duration
+	}{
+		{0, 0},
+		{5, 0},
+		{6, 30 * time.Second},
+		{7, time.Minute},
+		{8, 2 * time.Minute},
+		{10, 8 * time.Minute},
+		{11, 15 * time.Minute}, // 16 minutes, capped
+		{1000, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.failures), func(t *testing.T) {
+			if lock := throttle.lockFor(tt.failures); lock != tt.lock {
+				t.Errorf("lockFor(%d) = %v, want %v", tt.failures, lock, tt.lock)
+			}
+		})
+	}
+}
+
+func TestLoginLockedPerAccount(t *testing.T) {
+	s := newTestServer(t)
+
+	wrong := `{"email": "revolver.occelote@konami.jp", "password": "wrong1234"}`
+	for i := 0; i <= DefaultAccountThrottle.FreeAttempts; i++ {
+		if rec := s.do(http.MethodPost, "/pub/login", "", wrong); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("failure %d: status = %d, want %d", i+1, rec.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// Locked even with the right password, without telling whether it was right
+	rec := s.do(http.MethodPost, "/pub/login", "", `{"email": "revolver.occelote@konami.jp", "password": "ocelote1234"}`)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want 30", got)
+	}
+	if got := decodeBody[errorResponse](t, rec).Code; got != "too_many_requests" {
+		t.Errorf("code = %q, want too_many_requests", got)
+	}
+
+	// Other accounts from the same IP aren't locked
+	s.login("meryl.silverburgh@konami.jp", "meryl1234")
+}
+
+func TestLoginLockedPerIP(t *testing.T) {
+	s := newTestServer(t, WithClientIPHeader("X-Forwarded-For"))
+
+	login := func(ip string, email string, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/pub/login", strings.NewReader(`{"email": "`+email+`", "password": "`+password+`"}`))
+		req.Header.Set("X-Forwarded-For", "203.0.113.9, "+ip) // The first address comes from the client, and is ignored
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// One password tried on many accounts, none of them failing often enough to lock it
+	for i := 0; i <= DefaultIPThrottle.FreeAttempts; i++ {
+		if rec := login("192.0.2.1", fmt.Sprintf("user%d@parkfinder.com", i), "snake1234"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("failure %d: status = %d, want %d", i+1, rec.Code, http.StatusUnauthorized)
+		}
+	}
+
+	if rec := login("192.0.2.1", "admin@parkfinder.com", "snake1234"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("status from the IP = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec := login("192.0.2.2", "admin@parkfinder.com", "snake1234"); rec.Code != http.StatusOK {
+		t.Errorf("status from another IP = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+}
+
+func TestLoginEmailCase(t *testing.T) {
+	mailer := &recordingMailer{}
+	s := newTestServer(t, WithMailer(mailer))
+
+	register := strings.Replace(newUserJSON, `"laura@prueba.com"`, `" Laura@Prueba.com"`, 1)
+	if rec := s.do(http.MethodPost, "/pub/register", "", register); rec.Code != http.StatusCreated {
+		t.Fatalf("register status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := s.do(http.MethodPost, "/pub/register", "", newUserJSON); rec.Code != http.StatusConflict {
+		t.Errorf("register again in lower case: status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if rec := s.do(http.MethodGet, "/pub/verify-email?token="+mailer.mailedToken(t), "", ""); rec.Code != http.StatusOK {
+		t.Fatalf("verify status = %d: %s", rec.Code, rec.Body)
+	}
+	s.login("LAURA@prueba.com", "prueba1234")
+
+	// Failures count for the account whatever the case of the email, and so does the lock
+	for i := 0; i <= DefaultAccountThrottle.FreeAttempts; i++ {
+		wrong := `{"email": "` + []string{"laura@prueba.com", "LAURA@PRUEBA.COM"}[i%2] + `", "password": "wrong1234"}`
+		if rec := s.do(http.MethodPost, "/pub/login", "", wrong); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("failure %d: status = %d, want %d", i+1, rec.Code, http.StatusUnauthorized)
+		}
+	}
+	rec := s.do(http.MethodPost, "/pub/login", "", `{"email": "Laura@Prueba.com", "password": "prueba1234"}`)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+}
@@ -0,0 +1,1236 @@
+package themepark
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore is an in-memory implementation of Store. It mirrors the tables of database.sql and
+// behaves like DatabaseStore, so it can be used for tests and local development without PostgreSQL.
+// It is safe for concurrent use.
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	themeParks          map[int]ThemePark
+	timeZones           map[int]string // park id -> time zone, missing for the parks in UTC
+	categories          map[int]Category
+	themeParkCategories []ThemeparkCategory
+	attractions         map[int]Attraction
+	waitTimeReports     []WaitTimeReport
+	calendars           map[int]ParkCalendar // park id -> calendar, without the park id, name and time zone
+	ticketPrices        map[int]TicketPrice
+	users               map[int]User
+	tokenVersions       map[int]memoryTokenVersion // user id -> token version, missing until first bumped
+	usersCategories     []UsersCategory
+	tokens              map[string]memoryToken // token hash -> token
+	userTokens          map[string]memoryUserToken
+	loginFailures       map[string]memoryLoginFailure
+	comments            map[int]Comment
+	roleChanges         []RoleChange
+
+	sequences map[string]int // Last id used per table, like the identity sequences in PostgreSQL
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+type memoryToken struct {
+	userID  int
+	expires time.Time
+	family  string
+	refresh bool
+	used    bool
+}
+
+type memoryTokenVersion struct {
+	version int
+	revoked time.Time
+}
+
+type memoryUserToken struct {
+	userID  int
+	purpose string
+	expires time.Time
+	created time.Time
+}
+
+type memoryLoginFailure struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		themeParks:    map[int]ThemePark{},
+		timeZones:     map[int]string{},
+		categories:    map[int]Category{},
+		attractions:   map[int]Attraction{},
+		calendars:     map[int]ParkCalendar{},
+		ticketPrices:  map[int]TicketPrice{},
+		users:         map[int]User{},
+		tokenVersions: map[int]memoryTokenVersion{},
+		tokens:        map[string]memoryToken{},
+		userTokens:    map[string]memoryUserToken{},
+		loginFailures: map[string]memoryLoginFailure{},
+		comments:      map[int]Comment{},
+		sequences:     map[string]int{},
+	}
+}
+
+// NewMemoryStoreWithTestData returns a MemoryStore seeded with the test dataset from database.sql.
+func NewMemoryStoreWithTestData() *MemoryStore {
+	m := NewMemoryStore()
+	m.LoadTestDataset()
+	return m
+}
+
+func (m *MemoryStore) Close() {}
+
+// nextID returns the next identity for the given table. Must be called with the lock held.
+func (m *MemoryStore) nextID(table string) int {
+	m.sequences[table]++
+	return m.sequences[table]
+}
+
+// setID registers an explicitly set identity, like setval does after the test dataset inserts.
+// Must be called with the lock held.
+func (m *MemoryStore) setID(table string, id int) {
+	if id > m.sequences[table] {
+		m.sequences[table] = id
+	}
+}
+
+func (m *MemoryStore) GetUser(ctx context.Context, userID int) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return nil, fmt.Errorf("user %d: %w", userID, ErrNotFound)
+	}
+
+	user.Categories = m.userCategories(userID)
+
+	return &user, nil
+}
+
+// userCategories returns the category ids of a user. Must be called with the lock held.
+func (m *MemoryStore) userCategories(userID int) []int {
+	var userCategories []int
+	for _, userCategory := range m.usersCategories {
+		if userCategory.UserId == userID {
+			userCategories = append(userCategories, userCategory.CategoryId)
+		}
+	}
+
+	return userCategories
+}
+
+func (m *MemoryStore) UpdateUser(ctx context.Context, user User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[user.ID]
+	if !ok {
+		return fmt.Errorf("user %d: %w", user.ID, ErrNotFound)
+	}
+
+	for _, category := range user.Categories {
+		if _, ok := m.categories[category]; !ok {
+			return &ValidationError{Field: "categories", Message: "references a row that does not exist"}
+		}
+	}
+
+	// Email, password and access level are not updatable, as in DatabaseStore
+	stored.Name = user.Name
+	stored.BirthDate = user.BirthDate
+	stored.City = user.City
+	stored.ProfilePicture = user.ProfilePicture
+	stored.Description = user.Description
+	m.users[user.ID] = stored
+
+	m.setUserCategories(user.ID, user.Categories)
+
+	return nil
+}
+
+func (m *MemoryStore) SetUserAccessLevel(ctx context.Context, userID int, accessLevel int, changedBy int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return fmt.Errorf("user %d: %w", userID, ErrNotFound)
+	}
+
+	m.roleChanges = append(m.roleChanges, RoleChange{
+		Id:             m.nextID("role_changes"),
+		UserId:         userID,
+		ChangedBy:      &changedBy,
+		OldAccessLevel: user.AccessLevel,
+		NewAccessLevel: accessLevel,
+		Created:        time.Now(),
+	})
+
+	user.AccessLevel = accessLevel
+	m.users[userID] = user
+	m.revokeTokens(userID) // The signed access tokens carry the old access level
+
+	return nil
+}
+
+func (m *MemoryStore) GetRoleChanges(ctx context.Context, userID int) ([]RoleChange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	roleChanges := []RoleChange{}
+	for _, roleChange := range m.roleChanges {
+		if roleChange.UserId == userID {
+			roleChanges = append(roleChanges, roleChange)
+		}
+	}
+
+	return roleChanges, nil
+}
+
+// setUserCategories replaces the categories of a user. Must be called with the lock held.
+func (m *MemoryStore) setUserCategories(userID int, categories []int) {
+	var usersCategories []UsersCategory
+	for _, userCategory := range m.usersCategories {
+		if userCategory.UserId != userID {
+			usersCategories = append(usersCategories, userCategory)
+		}
+	}
+
+	for _, category := range categories {
+		usersCategories = append(usersCategories, UsersCategory{
+			Id:         m.nextID("users_categories"),
+			UserId:     userID,
+			CategoryId: category,
+			Created:    time.Now(),
+		})
+	}
+
+	m.usersCategories = usersCategories
+}
+
+func (m *MemoryStore) GetAllUsers(ctx context.Context) ([]User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var users []User
+	for _, user := range m.users {
+		user.Password = ""
+		user.Categories = m.userCategories(user.ID)
+		users = append(users, user)
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	return users, nil
+}
+
+func (m *MemoryStore) SignIn(ctx context.Context, userEmail string, userPass string, ttl SessionTTL) (Session, error) {
+	// Hashing is slow on purpose, so it runs without the lock and the user is checked again before starting the session
+	m.mu.RLock()
+	user, ok := m.userFromEmail(userEmail)
+	m.mu.RUnlock()
+	if !ok {
+		checkPassword(userPass, dummyHash())
+		return Session{}, fmt.Errorf("%w: invalid email or password", ErrUnauthorized)
+	}
+
+	// Check if password matches
+	match, rehash, err := checkPassword(userPass, user.Password)
+	if err != nil {
+		return Session{}, fmt.Errorf("user %s: %w", userEmail, err)
+	}
+
+	if !match {
+		return Session{}, fmt.Errorf("%w: invalid email or password", ErrUnauthorized)
+	}
+
+	if !user.EmailVerified {
+		return Session{}, fmt.Errorf("%w: email %s not verified", ErrForbidden, userEmail)
+	}
+
+	// Upgrade legacy SHA-256 hashes now that we know the password
+	var upgradedPass string
+	if rehash {
+		upgradedPass, _ = hashPassword(userPass)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The password checked must still be the one of the user
+	stored, ok := m.users[user.ID]
+	if !ok || stored.Password != user.Password {
+		return Session{}, fmt.Errorf("%w: invalid email or password", ErrUnauthorized)
+	}
+
+	if upgradedPass != "" {
+		stored.Password = upgradedPass
+		m.users[stored.ID] = stored
+	}
+
+	return m.insertSession(user.ID, uuid.NewString(), ttl), nil
+}
+
+func (m *MemoryStore) RefreshSession(ctx context.Context, refreshToken string, ttl SessionTTL) (Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.tokens[hashToken(refreshToken)]
+	if !ok || !stored.refresh || !stored.expires.After(time.Now()) {
+		return Session{}, fmt.Errorf("%w: invalid refresh token", ErrUnauthorized)
+	}
+
+	if stored.used {
+		m.deleteFamily(stored.family)
+		return Session{}, fmt.Errorf("%w: refresh token reused, session revoked", ErrUnauthorized)
+	}
+
+	stored.used = true
+	m.tokens[hashToken(refreshToken)] = stored
+
+	return m.insertSession(stored.userID, stored.family, ttl), nil
+}
+
+// insertSession stores new tokens for the user in the given family. Must be called with the lock held.
+func (m *MemoryStore) insertSession(userID int, family string, ttl SessionTTL) Session {
+	now := time.Now()
+	session := Session{
+		UserID:         userID,
+		RefreshToken:   uuid.NewString(),
+		RefreshExpires: now.Add(ttl.Refresh),
+	}
+	m.tokens[hashToken(session.RefreshToken)] = memoryToken{userID: userID, expires: session.RefreshExpires, family: family, refresh: true}
+
+	if ttl.Access > 0 {
+		session.AccessToken = uuid.NewString()
+		session.AccessExpires = now.Add(ttl.Access)
+		m.tokens[hashToken(session.AccessToken)] = memoryToken{userID: userID, expires: session.AccessExpires, family: family}
+	}
+
+	return session
+}
+
+// deleteFamily deletes all the tokens of a session. Must be called with the lock held.
+func (m *MemoryStore) deleteFamily(family string) {
+	for tokenHash, stored := range m.tokens {
+		if stored.family == family {
+			delete(m.tokens, tokenHash)
+		}
+	}
+}
+
+// userFromEmail looks up a user by email, normalized like the stored ones. Must be called with the lock held.
+func (m *MemoryStore) userFromEmail(email string) (User, bool) {
+	email = normalizeEmail(email)
+	for _, user := range m.users {
+		if user.Email == email {
+			return user, true
+		}
+	}
+
+	return User{}, false
+}
+
+func (m *MemoryStore) IsLoggedIn(ctx context.Context, token string) (bool, int, int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.tokens[hashToken(token)]
+	if !ok || stored.refresh || !stored.expires.After(time.Now()) {
+		return false, -1, -1
+	}
+
+	user, ok := m.users[stored.userID]
+	if !ok {
+		return false, -1, -1
+	}
+
+	return true, user.ID, user.AccessLevel
+}
+
+func (m *MemoryStore) DeleteSession(ctx context.Context, userID int, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.tokens[hashToken(token)]
+	if !ok || stored.userID != userID {
+		return fmt.Errorf("session: %w", ErrNotFound)
+	}
+
+	m.deleteFamily(stored.family)
+
+	return nil
+}
+
+func (m *MemoryStore) DeleteUserTokens(ctx context.Context, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for tokenHash, stored := range m.tokens {
+		if stored.userID == userID {
+			delete(m.tokens, tokenHash)
+		}
+	}
+	m.revokeTokens(userID)
+
+	return nil
+}
+
+// revokeTokens bumps the token version of the user, revoking their signed access tokens. Must be called with
+// the lock held.
+func (m *MemoryStore) revokeTokens(userID int) {
+	if _, ok := m.users[userID]; !ok {
+		return
+	}
+
+	m.tokenVersions[userID] = memoryTokenVersion{version: m.tokenVersions[userID].version + 1, revoked: time.Now()}
+}
+
+func (m *MemoryStore) GetTokenVersion(ctx context.Context, userID int) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.users[userID]; !ok {
+		return 0, fmt.Errorf("user %d: %w", userID, ErrNotFound)
+	}
+
+	return m.tokenVersions[userID].version, nil
+}
+
+func (m *MemoryStore) GetRevokedTokenVersions(ctx context.Context, since time.Time) (map[int]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	versions := map[int]int{}
+	for userID, stored := range m.tokenVersions {
+		if !stored.revoked.Before(since) {
+			versions[userID] = stored.version
+		}
+	}
+
+	return versions, nil
+}
+
+func (m *MemoryStore) DeleteExpiredTokens(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	now := time.Now()
+	for tokenHash, stored := range m.tokens {
+		if !stored.expires.After(now) {
+			delete(m.tokens, tokenHash)
+			deleted++
+		}
+	}
+	for tokenHash, stored := range m.userTokens {
+		if !stored.expires.After(now) {
+			delete(m.userTokens, tokenHash)
+			deleted++
+		}
+	}
+	for key, stored := range m.loginFailures {
+		if stored.lastFailure.Before(now.Add(-24*time.Hour)) && stored.lockedUntil.Before(now) {
+			delete(m.loginFailures, key)
+		}
+	}
+
+	return deleted, nil
+}
+
+func (m *MemoryStore) LoginLockedUntil(ctx context.Context, keys ...string) (time.Time, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var lockedUntil time.Time
+	for _, key := range keys {
+		if stored := m.loginFailures[key]; stored.lockedUntil.After(lockedUntil) {
+			lockedUntil = stored.lockedUntil
+		}
+	}
+
+	return lockedUntil, nil
+}
+
+func (m *MemoryStore) RecordLoginFailure(ctx context.Context, key string, throttle LoginThrottle) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	stored := m.loginFailures[key]
+	if stored.lastFailure.Before(now.Add(-throttle.Window)) {
+		stored.failures = 0
+	}
+	stored.failures++
+	stored.lastFailure = now
+
+	if lock := throttle.lockFor(stored.failures); lock > 0 {
+		stored.lockedUntil = now.Add(lock)
+	}
+	m.loginFailures[key] = stored
+
+	if stored.lockedUntil.After(now) {
+		return stored.lockedUntil, nil
+	}
+
+	return time.Time{}, nil
+}
+
+func (m *MemoryStore) ResetLoginFailures(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.loginFailures, key)
+
+	return nil
+}
+
+func (m *MemoryStore) CreateEmailVerification(ctx context.Context, email string, ttl time.Duration) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.userFromEmail(email)
+	if !ok {
+		return "", fmt.Errorf("user %s: %w", email, ErrNotFound)
+	}
+
+	if user.EmailVerified {
+		return "", fmt.Errorf("email %s already verified: %w", email, ErrConflict)
+	}
+
+	now := time.Now()
+	token := uuid.NewString()
+	m.userTokens[hashToken(token)] = memoryUserToken{userID: user.ID, purpose: UserTokenVerifyEmail, expires: now.Add(ttl), created: now}
+
+	return token, nil
+}
+
+func (m *MemoryStore) VerifyEmail(ctx context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.userTokens[hashToken(token)]
+	if !ok || stored.purpose != UserTokenVerifyEmail || !stored.expires.After(time.Now()) {
+		return fmt.Errorf("verification token: %w", ErrNotFound)
+	}
+	delete(m.userTokens, hashToken(token))
+
+	if user, ok := m.users[stored.userID]; ok {
+		user.EmailVerified = true
+		m.users[user.ID] = user
+	}
+
+	return nil
+}
+
+func (m *MemoryStore) ChangePassword(ctx context.Context, userID int, currentPassword string, newPassword string) error {
+	hashedPass, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	// Checked without the lock, like in SignIn
+	m.mu.RLock()
+	user, ok := m.users[userID]
+	m.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("user %d: %w", userID, ErrNotFound)
+	}
+
+	match, _, err := checkPassword(currentPassword, user.Password)
+	if err != nil {
+		return fmt.Errorf("user %d: %w", userID, err)
+	}
+	if !match {
+		return fmt.Errorf("%w: wrong current password", ErrUnauthorized)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The password checked must still be the one of the user
+	stored, ok := m.users[userID]
+	if !ok || stored.Password != user.Password {
+		return fmt.Errorf("%w: wrong current password", ErrUnauthorized)
+	}
+
+	m.setPassword(stored, hashedPass)
+
+	return nil
+}
+
+func (m *MemoryStore) CreatePasswordReset(ctx context.Context, email string, ttl time.Duration) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.userFromEmail(email)
+	if !ok {
+		return "", fmt.Errorf("user %s: %w", email, ErrNotFound)
+	}
+
+	now := time.Now()
+	token := uuid.NewString()
+	m.userTokens[hashToken(token)] = memoryUserToken{userID: user.ID, purpose: UserTokenResetPassword, expires: now.Add(ttl), created: now}
+
+	return token, nil
+}
+
+func (m *MemoryStore) ResetPassword(ctx context.Context, token string, newPassword string) error {
+	hashedPass, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.userTokens[hashToken(token)]
+	if !ok || stored.purpose != UserTokenResetPassword || !stored.expires.After(time.Now()) {
+		return fmt.Errorf("password reset token: %w", ErrNotFound)
+	}
+
+	user, ok := m.users[stored.userID]
+	if !ok {
+		return fmt.Errorf("password reset token: %w", ErrNotFound)
+	}
+
+	// The other reset links are useless now, and getting one proves the email works
+	for tokenHash, other := range m.userTokens {
+		if other.userID == user.ID && other.purpose == UserTokenResetPassword {
+			delete(m.userTokens, tokenHash)
+		}
+	}
+	user.EmailVerified = true
+
+	m.setPassword(user, hashedPass)
+
+	return nil
+}
+
+// setPassword saves the hash of a new password, deletes the tokens of the user and revokes their signed access
+// tokens. Must be called with the lock held.
+func (m *MemoryStore) setPassword(user User, hashedPass string) {
+	user.Password = hashedPass
+	m.users[user.ID] = user
+
+	for tokenHash, stored := range m.tokens {
+		if stored.userID == user.ID {
+			delete(m.tokens, tokenHash)
+		}
+	}
+	m.revokeTokens(user.ID)
+}
+
+func (m *MemoryStore) CountUserTokens(ctx context.Context, email string, purpose string, since time.Time) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.userFromEmail(email)
+	if !ok {
+		return 0, nil
+	}
+
+	var count int
+	for _, stored := range m.userTokens {
+		if stored.userID == user.ID && stored.purpose == purpose && stored.created.After(since) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (m *MemoryStore) GetAllCategories(ctx context.Context) ([]Category, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var categories []Category
+	for _, category := range m.categories {
+		categories = append(categories, category)
+	}
+
+	sort.Slice(categories, func(i, j int) bool { return categories[i].Id < categories[j].Id })
+
+	return categories, nil
+}
+
+func (m *MemoryStore) AddCategory(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.nextID("categories")
+	m.categories[id] = Category{Id: id, Name: name, Created: time.Now()}
+
+	return nil
+}
+
+func (m *MemoryStore) AddUser(ctx context.Context, user User) error {
+	// Hashed without the lock, like in SignIn
+	hashedPass, err := hashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.userFromEmail(user.Email); ok {
+		return fmt.Errorf("email %w", ErrConflict)
+	}
+
+	for _, category := range user.Categories {
+		if _, ok := m.categories[category]; !ok {
+			return &ValidationError{Field: "categories", Message: "references a row that does not exist"}
+		}
+	}
+
+	user.ID = m.nextID("users")
+	user.Email = normalizeEmail(user.Email)
+	user.Password = hashedPass
+	user.AccessLevel = UserAccessLevel
+	user.EmailVerified = false
+	categories := user.Categories
+	user.Categories = nil
+	m.users[user.ID] = user
+
+	m.setUserCategories(user.ID, categories)
+
+	return nil
+}
+
+func (m *MemoryStore) GetAllThemeParks(ctx context.Context, filter ParkFilter) ([]ThemePark, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	var themeparks []ThemePark
+	for _, stored := range m.themeParks {
+		themeparks = append(themeparks, ThemePark{
+			Id:         stored.Id,
+			Name:       stored.Name,
+			Picture:    stored.Picture,
+			Categories: m.themeParkCategoryList(stored.Id),
+			Prices:     currentPrices(m.parkTicketPrices(stored.Id), m.parkTimeZone(stored.Id), now),
+		})
+	}
+
+	return filterParks(themeparks, filter), nil
+}
+
+// themeParkCategoryList returns the categories of a theme park. Must be called with the lock held.
+func (m *MemoryStore) themeParkCategoryList(parkID int) []Category {
+	var categories []Category
+	for _, parkCategory := range m.themeParkCategories {
+		if parkCategory.ThemeparkId == parkID {
+			categories = append(categories, m.categories[parkCategory.CategoryId])
+		}
+	}
+
+	return categories
+}
+
+func (m *MemoryStore) GetThemeParkDetail(ctx context.Context, parkID int, filter AttractionFilter) (*ThemePark, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	themepark, ok := m.themeParks[parkID]
+	if !ok {
+		return nil, fmt.Errorf("themepark %d: %w", parkID, ErrNotFound)
+	}
+
+	themepark.Categories = m.themeParkCategoryList(parkID)
+
+	// Get comments
+	var comments []Comment
+	for _, comment := range m.comments {
+		if comment.ThemeparkId == parkID {
+			comment.UserName = m.users[comment.UserId].Name
+			comment.ThemeparkId = 0
+			comments = append(comments, comment)
+		}
+	}
+	sort.Slice(comments, func(i, j int) bool {
+		if comments[i].Created.Equal(comments[j].Created) {
+			return comments[i].Id < comments[j].Id
+		}
+		return comments[i].Created.Before(comments[j].Created)
+	})
+	themepark.Comments = comments
+
+	// Get attractions
+	themepark.Attractions = filterAttractions(m.parkAttractions(parkID), filter)
+
+	// Get wait times
+	now := time.Now()
+	attractionIDs := make([]int, len(themepark.Attractions))
+	for i, attraction := range themepark.Attractions {
+		attractionIDs[i] = attraction.Id
+	}
+	attachWaitTimes(themepark.Attractions, m.waitTimeReportsOf(attractionIDs, now.Add(-waitHistoryWindow)),
+		parkLocation(m.parkTimeZone(parkID)), now)
+
+	// Get current prices
+	themepark.Prices = currentPrices(m.parkTicketPrices(parkID), m.parkTimeZone(parkID), now)
+
+	return &themepark, nil
+}
+
+// parkAttractions returns the attractions of a theme park, by id. Must be called with the lock held.
+func (m *MemoryStore) parkAttractions(parkID int) []Attraction {
+	var attractions []Attraction
+	for _, attraction := range m.attractions {
+		if attraction.ThemeparkId == parkID {
+			attractions = append(attractions, attraction)
+		}
+	}
+	sort.Slice(attractions, func(i, j int) bool { return attractions[i].Id < attractions[j].Id })
+
+	return attractions
+}
+
+func (m *MemoryStore) InsertParkComment(ctx context.Context, parkID int, userId int, comment string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.themeParks[parkID]; !ok {
+		return &ValidationError{Field: "themepark_id", Message: "references a row that does not exist"}
+	}
+	if _, ok := m.users[userId]; !ok {
+		return &ValidationError{Field: "user_id", Message: "references a row that does not exist"}
+	}
+
+	id := m.nextID("comments")
+	m.comments[id] = Comment{Id: id, UserId: userId, ThemeparkId: parkID, Comment: comment, Created: time.Now()}
+
+	return nil
+}
+
+func (m *MemoryStore) AddThemePark(ctx context.Context, themePark ThemePark) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.themeParks {
+		if stored.Name == themePark.Name {
+			return fmt.Errorf("name %w", ErrConflict)
+		}
+	}
+
+	for _, category := range themePark.Categories {
+		if _, ok := m.categories[category.Id]; !ok {
+			return &ValidationError{Field: "categories", Message: "references a row that does not exist"}
+		}
+	}
+
+	themePark.Id = m.nextID("themeparks")
+	m.storeThemePark(themePark)
+
+	return nil
+}
+
+// storeThemePark saves the theme park fields and replaces its categories. Must be called with the lock held.
+func (m *MemoryStore) storeThemePark(themePark ThemePark) {
+	m.themeParks[themePark.Id] = ThemePark{
+		Id:          themePark.Id,
+		Name:        themePark.Name,
+		Description: themePark.Description,
+		Picture:     themePark.Picture,
+		Latitude:    themePark.Latitude,
+		Longitude:   themePark.Longitude,
+	}
+
+	var themeParkCategories []ThemeparkCategory
+	for _, parkCategory := range m.themeParkCategories {
+		if parkCategory.ThemeparkId != themePark.Id {
+			themeParkCategories = append(themeParkCategories, parkCategory)
+		}
+	}
+
+	for _, category := range themePark.Categories {
+		themeParkCategories = append(themeParkCategories, ThemeparkCategory{
+			Id:          m.nextID("themeparks_categories"),
+			ThemeparkId: themePark.Id,
+			CategoryId:  category.Id,
+			Created:     time.Now(),
+		})
+	}
+
+	m.themeParkCategories = themeParkCategories
+}
+
+func (m *MemoryStore) DeleteThemePark(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.themeParks[id]; !ok {
+		return fmt.Errorf("themepark %d: %w", id, ErrNotFound)
+	}
+
+	delete(m.themeParks, id)
+	delete(m.timeZones, id)
+
+	// Cascade like the foreign keys in database.sql
+	var themeParkCategories []ThemeparkCategory
+	for _, parkCategory := range m.themeParkCategories {
+		if parkCategory.ThemeparkId != id {
+			themeParkCategories = append(themeParkCategories, parkCategory)
+		}
+	}
+	m.themeParkCategories = themeParkCategories
+
+	for attractionID, attraction := range m.attractions {
+		if attraction.ThemeparkId == id {
+			delete(m.attractions, attractionID)
+			m.deleteWaitTimeReports(attractionID)
+		}
+	}
+
+	for commentID, comment := range m.comments {
+		if comment.ThemeparkId == id {
+			delete(m.comments, commentID)
+		}
+	}
+
+	delete(m.calendars, id)
+
+	for priceID, price := range m.ticketPrices {
+		if price.ThemeparkId == id {
+			delete(m.ticketPrices, priceID)
+		}
+	}
+
+	return nil
+}
+
+func (m *MemoryStore) UpdateThemePark(ctx context.Context, themePark ThemePark) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.themeParks[themePark.Id]; !ok {
+		return fmt.Errorf("themepark %d: %w", themePark.Id, ErrNotFound)
+	}
+
+	for _, stored := range m.themeParks {
+		if stored.Name == themePark.Name && stored.Id != themePark.Id {
+			return fmt.Errorf("name %w", ErrConflict)
+		}
+	}
+
+	for _, category := range themePark.Categories {
+		if _, ok := m.categories[category.Id]; !ok {
+			return &ValidationError{Field: "categories", Message: "references a row that does not exist"}
+		}
+	}
+
+	m.storeThemePark(themePark)
+
+	return nil
+}
+
+func (m *MemoryStore) GetParkAttractions(ctx context.Context, parkID int, filter AttractionFilter) ([]Attraction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.themeParks[parkID]; !ok {
+		return nil, fmt.Errorf("themepark %d: %w", parkID, ErrNotFound)
+	}
+
+	return filterAttractions(m.parkAttractions(parkID), filter), nil
+}
+
+func (m *MemoryStore) GetAttraction(ctx context.Context, parkID int, attractionID int) (*Attraction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	attraction, ok := m.attractions[attractionID]
+	if !ok || attraction.ThemeparkId != parkID {
+		return nil, fmt.Errorf("attraction %d of themepark %d: %w", attractionID, parkID, ErrNotFound)
+	}
+
+	return &attraction, nil
+}
+
+func (m *MemoryStore) AddAttraction(ctx context.Context, attraction Attraction) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.themeParks[attraction.ThemeparkId]; !ok {
+		return 0, fmt.Errorf("themepark %d: %w", attraction.ThemeparkId, ErrNotFound)
+	}
+
+	attraction.Id = m.nextID("attractions")
+	attraction.Created = time.Now()
+	m.attractions[attraction.Id] = attraction
+
+	return attraction.Id, nil
+}
+
+func (m *MemoryStore) UpdateAttraction(ctx context.Context, attraction Attraction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.attractions[attraction.Id]
+	if !ok || stored.ThemeparkId != attraction.ThemeparkId {
+		return fmt.Errorf("attraction %d of themepark %d: %w", attraction.Id, attraction.ThemeparkId, ErrNotFound)
+	}
+
+	attraction.Created = stored.Created
+	m.attractions[attraction.Id] = attraction
+
+	return nil
+}
+
+func (m *MemoryStore) DeleteAttraction(ctx context.Context, parkID int, attractionID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.attractions[attractionID]
+	if !ok || stored.ThemeparkId != parkID {
+		return fmt.Errorf("attraction %d of themepark %d: %w", attractionID, parkID, ErrNotFound)
+	}
+
+	delete(m.attractions, attractionID)
+	m.deleteWaitTimeReports(attractionID)
+
+	return nil
+}
+
+// deleteWaitTimeReports deletes the reports of an attraction. Must be called with the lock held.
+func (m *MemoryStore) deleteWaitTimeReports(attractionID int) {
+	m.waitTimeReports = slices.DeleteFunc(m.waitTimeReports, func(report WaitTimeReport) bool {
+		return report.AttractionId == attractionID
+	})
+}
+
+func (m *MemoryStore) AddWaitTimeReport(ctx context.Context, parkID int, report WaitTimeReport) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attraction, ok := m.attractions[report.AttractionId]
+	if !ok || attraction.ThemeparkId != parkID {
+		return fmt.Errorf("attraction %d of themepark %d: %w", report.AttractionId, parkID, ErrNotFound)
+	}
+	if _, ok := m.users[report.UserId]; !ok {
+		return &ValidationError{Field: "user_id", Message: "references a row that does not exist"}
+	}
+
+	report.Id = m.nextID("wait_time_reports")
+	report.Created = time.Now()
+	m.waitTimeReports = append(m.waitTimeReports, report)
+
+	return nil
+}
+
+func (m *MemoryStore) GetWaitTimes(ctx context.Context, parkID int, attractionID int) (*WaitTimes, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	attraction, ok := m.attractions[attractionID]
+	if !ok || attraction.ThemeparkId != parkID {
+		return nil, fmt.Errorf("attraction %d of themepark %d: %w", attractionID, parkID, ErrNotFound)
+	}
+
+	now := time.Now()
+	reports := m.waitTimeReportsOf([]int{attractionID}, now.Add(-waitHistoryWindow))
+
+	return waitTimesOf(reports, parkLocation(m.parkTimeZone(parkID)), now), nil
+}
+
+// waitTimeReportsOf returns the reports of the attractions since the given time. Must be called with the lock held.
+func (m *MemoryStore) waitTimeReportsOf(attractionIDs []int, since time.Time) []WaitTimeReport {
+	var reports []WaitTimeReport
+	for _, report := range m.waitTimeReports {
+		if slices.Contains(attractionIDs, report.AttractionId) && !report.Created.Before(since) {
+			reports = append(reports, report)
+		}
+	}
+
+	return reports
+}
+
+// parkTimeZone returns the time zone of a theme park. Must be called with the lock held.
+func (m *MemoryStore) parkTimeZone(parkID int) string {
+	if timeZone, ok := m.timeZones[parkID]; ok {
+		return timeZone
+	}
+
+	return "UTC" // Like the column default
+}
+
+func (m *MemoryStore) GetParkCalendar(ctx context.Context, parkID int) (*ParkCalendar, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	themePark, ok := m.themeParks[parkID]
+	if !ok {
+		return nil, fmt.Errorf("themepark %d: %w", parkID, ErrNotFound)
+	}
+
+	calendar := m.calendars[parkID]
+	calendar.TimeZone = m.parkTimeZone(parkID)
+	calendar.ThemeparkId = parkID
+	calendar.ThemeparkName = themePark.Name
+	calendar.Weekly = slices.Clone(calendar.Weekly)
+	calendar.Exceptions = slices.Clone(calendar.Exceptions)
+
+	return &calendar, nil
+}
+
+func (m *MemoryStore) SetParkCalendar(ctx context.Context, parkID int, calendar ParkCalendar) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.themeParks[parkID]; !ok {
+		return fmt.Errorf("themepark %d: %w", parkID, ErrNotFound)
+	}
+
+	// Like the tables, closed dates have no opening hours
+	exceptions := slices.Clone(calendar.Exceptions)
+	for i := range exceptions {
+		if exceptions[i].Closed {
+			exceptions[i].Opens, exceptions[i].Closes = "", ""
+		}
+	}
+
+	// Sorted like the queries of DatabaseStore
+	weekly := slices.Clone(calendar.Weekly)
+	sort.SliceStable(weekly, func(i, j int) bool {
+		weekdayI, _ := parseWeekday(weekly[i].Weekday)
+		weekdayJ, _ := parseWeekday(weekly[j].Weekday)
+		if weekdayI != weekdayJ {
+			return weekdayI < weekdayJ
+		}
+		return weekly[i].Opens < weekly[j].Opens
+	})
+	sort.SliceStable(exceptions, func(i, j int) bool {
+		if exceptions[i].Date != exceptions[j].Date {
+			return exceptions[i].Date < exceptions[j].Date
+		}
+		return exceptions[i].Opens < exceptions[j].Opens
+	})
+
+	m.timeZones[parkID] = calendar.TimeZone
+	m.calendars[parkID] = ParkCalendar{
+		Weekly:     weekly,
+		Exceptions: exceptions,
+	}
+
+	return nil
+}
+
+// parkTicketPrices returns the ticket prices of a theme park, sorted. Must be called with the lock held.
+func (m *MemoryStore) parkTicketPrices(parkID int) []TicketPrice {
+	var prices []TicketPrice
+	for _, price := range m.ticketPrices {
+		if price.ThemeparkId == parkID {
+			prices = append(prices, price)
+		}
+	}
+	sortTicketPrices(prices)
+
+	return prices
+}
+
+func (m *MemoryStore) GetParkTicketPrices(ctx context.Context, parkID int) ([]TicketPrice, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.themeParks[parkID]; !ok {
+		return nil, fmt.Errorf("themepark %d: %w", parkID, ErrNotFound)
+	}
+
+	return m.parkTicketPrices(parkID), nil
+}
+
+func (m *MemoryStore) GetTicketPrice(ctx context.Context, parkID int, priceID int) (*TicketPrice, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	price, ok := m.ticketPrices[priceID]
+	if !ok || price.ThemeparkId != parkID {
+		return nil, fmt.Errorf("ticket price %d of themepark %d: %w", priceID, parkID, ErrNotFound)
+	}
+
+	return &price, nil
+}
+
+func (m *MemoryStore) AddTicketPrice(ctx context.Context, price TicketPrice) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.themeParks[price.ThemeparkId]; !ok {
+		return 0, fmt.Errorf("themepark %d: %w", price.ThemeparkId, ErrNotFound)
+	}
+
+	err := m.checkTicketPriceOverlap(price)
+	if err != nil {
+		return 0, err
+	}
+
+	price.Id = m.nextID("ticket_prices")
+	price.Created = time.Now()
+	m.ticketPrices[price.Id] = price
+
+	return price.Id, nil
+}
+
+func (m *MemoryStore) UpdateTicketPrice(ctx context.Context, price TicketPrice) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.themeParks[price.ThemeparkId]; !ok {
+		return fmt.Errorf("themepark %d: %w", price.ThemeparkId, ErrNotFound)
+	}
+
+	stored, ok := m.ticketPrices[price.Id]
+	if !ok || stored.ThemeparkId != price.ThemeparkId {
+		return fmt.Errorf("ticket price %d of themepark %d: %w", price.Id, price.ThemeparkId, ErrNotFound)
+	}
+
+	err := m.checkTicketPriceOverlap(price)
+	if err != nil {
+		return err
+	}
+
+	price.Created = stored.Created
+	m.ticketPrices[price.Id] = price
+
+	return nil
+}
+
+// checkTicketPriceOverlap fails with ErrConflict if another price of the tier is valid on the same dates.
+// Must be called with the lock held.
+func (m *MemoryStore) checkTicketPriceOverlap(price TicketPrice) error {
+	for _, other := range m.parkTicketPrices(price.ThemeparkId) {
+		if other.Id != price.Id && price.overlaps(other) {
+			return fmt.Errorf("%s price valid on the same dates %w", price.Tier, ErrConflict)
+		}
+	}
+
+	return nil
+}
+
+func (m *MemoryStore) DeleteTicketPrice(ctx context.Context, parkID int, priceID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.ticketPrices[priceID]
+	if !ok || stored.ThemeparkId != parkID {
+		return fmt.Errorf("ticket price %d of themepark %d: %w", priceID, parkID, ErrNotFound)
+	}
+
+	delete(m.ticketPrices, priceID)
+
+	return nil
+}
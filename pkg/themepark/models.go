@@ -1,6 +1,9 @@
 package themepark
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type User struct {
 	ID             int       `json:"id,omitempty"`
@@ -8,6 +11,7 @@ type User struct {
 	Email          string    `json:"email"`
 	Password       string    `json:"password,omitempty"`
 	AccessLevel    int       `json:"access_level,omitempty"`
+	EmailVerified  bool      `json:"email_verified"` // Users can't log in until they verify their email
 	BirthDate      time.Time `json:"birth_date"`
 	City           string    `json:"city"`
 	Categories     []int     `json:"categories"`
@@ -15,14 +19,77 @@ type User struct {
 	Description    string    `json:"description"`
 }
 
+// MarshalJSON leaves the password out, so its hash never reaches a response. Password is only read from
+// the register payload.
+func (u User) MarshalJSON() ([]byte, error) {
+	type user User // Without the MarshalJSON method, to not recurse
+	withoutPassword := user(u)
+	withoutPassword.Password = ""
+
+	return json.Marshal(withoutPassword)
+}
+
+// RoleChange is the audit record of an admin changing the access level of a user
+type RoleChange struct {
+	Id             int       `json:"id"`
+	UserId         int       `json:"user_id"`
+	ChangedBy      *int      `json:"changed_by"` // Nil if the admin was deleted
+	OldAccessLevel int       `json:"old_access_level"`
+	NewAccessLevel int       `json:"new_access_level"`
+	Created        time.Time `json:"created"`
+}
+
+type RoleRequest struct {
+	AccessLevel int `json:"access_level"`
+}
+
+// Purposes of the one-time tokens sent by email
+const (
+	UserTokenVerifyEmail   = "verify_email"
+	UserTokenResetPassword = "reset_password"
+)
+
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type PasswordReset struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
 type UserLogin struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
 type Token struct {
-	UserId      int    `json:"user_id"`
-	AccessToken string `json:"access_token"`
+	UserId           int    `json:"user_id"`
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int    `json:"expires_in"` // Seconds until the access token expires
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresIn int    `json:"refresh_expires_in"` // Seconds until the refresh token expires
+}
+
+// Session holds the tokens given at login or refresh. The stores keep only their hashes.
+type Session struct {
+	UserID         int
+	AccessToken    string // Empty with signed access tokens, which aren't stored
+	AccessExpires  time.Time
+	RefreshToken   string
+	RefreshExpires time.Time
+}
+
+// SessionTTL is how long the tokens of a session are valid. A zero Access doesn't store an access token,
+// for signed access tokens.
+type SessionTTL struct {
+	Access  time.Duration
+	Refresh time.Duration
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
 type Category struct {
@@ -54,21 +121,235 @@ type Comment struct {
 	Created     time.Time `json:"created"`
 }
 
+// Attraction is a ride or show of a theme park. The restrictions and figures are optional, nil when unknown.
 type Attraction struct {
+	Id              int                     `json:"id"`
+	ThemeparkId     int                     `json:"themepark_id"`
+	Name            string                  `json:"name"`
+	Type            string                  `json:"type"`   // One of the AttractionType constants
+	Status          string                  `json:"status"` // One of the AttractionStatus constants
+	MinHeight       *int                    `json:"min_height_cm,omitempty"`
+	MaxHeight       *int                    `json:"max_height_cm,omitempty"`
+	MinAge          *int                    `json:"min_age,omitempty"`
+	ThrillLevel     *int                    `json:"thrill_level,omitempty"` // From 1, gentle, to 5, extreme
+	Duration        *int                    `json:"duration_seconds,omitempty"`
+	CapacityPerHour *int                    `json:"capacity_per_hour,omitempty"`
+	Accessibility   AttractionAccessibility `json:"accessibility"`
+	WaitTimes       *WaitTimes              `json:"wait_times,omitempty"` // Only in the park detail, nil without reports
+	Created         time.Time               `json:"created"`
+}
+
+// AttractionAccessibility are the accessibility flags of an attraction
+type AttractionAccessibility struct {
+	WheelchairAccessible bool `json:"wheelchair_accessible"` // Riders can stay in their wheelchair
+	TransferRequired     bool `json:"transfer_required"`     // Riders have to move from the wheelchair to the seat
+	CompanionRequired    bool `json:"companion_required"`    // Riders with disabilities need someone with them
+	SensoryFriendly      bool `json:"sensory_friendly"`      // No loud noises, flashing lights or sudden drops
+}
+
+// Types of attraction
+const (
+	AttractionTypeCoaster   = "coaster"
+	AttractionTypeWaterRide = "water_ride"
+	AttractionTypeDarkRide  = "dark_ride"
+	AttractionTypeFlatRide  = "flat_ride"
+	AttractionTypeDropTower = "drop_tower"
+	AttractionTypeKidsRide  = "kids_ride"
+	AttractionTypeShow      = "show"
+	AttractionTypeOther     = "other"
+)
+
+// AttractionTypes are all the valid attraction types
+var AttractionTypes = []string{
+	AttractionTypeCoaster, AttractionTypeWaterRide, AttractionTypeDarkRide, AttractionTypeFlatRide,
+	AttractionTypeDropTower, AttractionTypeKidsRide, AttractionTypeShow, AttractionTypeOther,
+}
+
+// Operational status of an attraction
+const (
+	AttractionStatusOpen        = "open"
+	AttractionStatusClosed      = "closed"
+	AttractionStatusMaintenance = "maintenance"
+	AttractionStatusSeasonal    = "seasonal" // Only open in some seasons, like water rides in summer
+)
+
+// AttractionStatuses are all the valid attraction statuses
+var AttractionStatuses = []string{
+	AttractionStatusOpen, AttractionStatusClosed, AttractionStatusMaintenance, AttractionStatusSeasonal,
+}
+
+// withDefaults returns the attraction with the type and status it gets when the payload leaves them out
+func (a Attraction) withDefaults() Attraction {
+	if a.Type == "" {
+		a.Type = AttractionTypeOther
+	}
+	if a.Status == "" {
+		a.Status = AttractionStatusOpen
+	}
+
+	return a
+}
+
+// WaitTimeReport is the wait time of an attraction reported by a user
+type WaitTimeReport struct {
+	Id           int       `json:"id"`
+	AttractionId int       `json:"attraction_id"`
+	UserId       int       `json:"user_id"`
+	WaitMinutes  int       `json:"wait_minutes"`
+	Created      time.Time `json:"created"`
+}
+
+// WaitTimeRequest is the body of a wait time report
+type WaitTimeRequest struct {
+	WaitMinutes *int `json:"wait_minutes"` // 0 is a valid wait time
+}
+
+// WaitTimes are the current and historical wait times of an attraction, computed from the reports
+type WaitTimes struct {
+	Current   *WaitTimeEstimate `json:"current,omitempty"` // Nil without recent reports
+	ByHour    []HourWaitTime    `json:"by_hour,omitempty"`
+	ByWeekday []WeekdayWaitTime `json:"by_weekday,omitempty"`
+}
+
+// WaitTimeEstimate is the current wait time of an attraction
+type WaitTimeEstimate struct {
+	Minutes    int       `json:"minutes"`
+	Reports    int       `json:"reports"` // Recent reports used, the latest of every user without the outliers
+	LastReport time.Time `json:"last_report"`
+}
+
+// HourWaitTime is the average wait time at an hour of the day, in the time zone of the park
+type HourWaitTime struct {
+	Hour           int     `json:"hour"`
+	AverageMinutes float64 `json:"average_minutes"`
+	Reports        int     `json:"reports"`
+}
+
+// WeekdayWaitTime is the average wait time on a day of the week
+type WeekdayWaitTime struct {
+	Weekday        string  `json:"weekday"` // monday to sunday
+	AverageMinutes float64 `json:"average_minutes"`
+	Reports        int     `json:"reports"`
+}
+
+// ParkCalendar are the opening hours of a park: a weekly schedule and the exceptions to it on given dates.
+// Times are "HH:MM" in the time zone of the park, and a day can have several opening hours.
+type ParkCalendar struct {
+	ThemeparkId   int           `json:"themepark_id"`   // Set by the store
+	ThemeparkName string        `json:"themepark_name"` // Set by the store
+	TimeZone      string        `json:"time_zone"`      // IANA name, e.g. "Europe/Madrid"
+	Weekly        []WeeklyHours `json:"weekly"`
+	Exceptions    []DateHours   `json:"exceptions,omitempty"` // Replace the weekly hours of their date
+}
+
+// WeeklyHours are opening hours of a day of the regular week
+type WeeklyHours struct {
+	Weekday string `json:"weekday"` // monday to sunday
+	Opens   string `json:"opens"`
+	Closes  string `json:"closes"` // Up to "24:00"
+}
+
+// DateHours are the opening hours of a given date, or its closure
+type DateHours struct {
+	Date   string `json:"date"` // YYYY-MM-DD
+	Closed bool   `json:"closed,omitempty"`
+	Opens  string `json:"opens,omitempty"`
+	Closes string `json:"closes,omitempty"`
+	Note   string `json:"note,omitempty"` // e.g. "Halloween night" or "Closed for Christmas"
+}
+
+// DaySchedule are the opening hours of a park on a date, from its calendar
+type DaySchedule struct {
+	Date   string         `json:"date"`
+	Closed bool           `json:"closed"`
+	Hours  []OpeningHours `json:"hours,omitempty"`
+	Note   string         `json:"note,omitempty"`
+}
+
+// ParkSchedule are the opening hours of a park on a range of dates
+type ParkSchedule struct {
+	ThemeparkId int           `json:"themepark_id"`
+	TimeZone    string        `json:"time_zone"`
+	Days        []DaySchedule `json:"days"`
+}
+
+// OpeningHours is the time a park opens and closes on a day
+type OpeningHours struct {
+	Opens  string `json:"opens"`
+	Closes string `json:"closes"`
+}
+
+// OpenStatus says whether a park is open at an instant
+type OpenStatus struct {
+	Open        bool       `json:"open"`
+	At          time.Time  `json:"at"`
+	Closes      *time.Time `json:"closes,omitempty"`       // When open
+	NextOpening *time.Time `json:"next_opening,omitempty"` // When closed, if it opens in the next weeks
+}
+
+// AttractionFilter selects the attractions of a park. Zero fields don't filter.
+type AttractionFilter struct {
+	Types                []string
+	Statuses             []string
+	Height               int // Of the rider in cm, leaves out the attractions outside its height limits
+	Age                  int // Of the rider, leaves out the attractions with a higher minimum age
+	MaxThrillLevel       int // Leaves out the attractions with a higher or unknown thrill level
+	WheelchairAccessible bool
+	SensoryFriendly      bool
+}
+
+// Ticket tiers
+const (
+	TicketTierAdult      = "adult"
+	TicketTierChild      = "child"
+	TicketTierSenior     = "senior"
+	TicketTierSeasonPass = "season_pass"
+)
+
+// TicketTiers are all the valid ticket tiers
+var TicketTiers = []string{TicketTierAdult, TicketTierChild, TicketTierSenior, TicketTierSeasonPass}
+
+// TicketPrice is the price of a ticket tier of a park, valid between two dates. Prices of the same tier
+// can't be valid on the same date.
+type TicketPrice struct {
 	Id          int       `json:"id"`
 	ThemeparkId int       `json:"themepark_id"`
-	Name        string    `json:"name"`
+	Tier        string    `json:"tier"`
+	AmountCents *int      `json:"amount_cents"`         // In cents, the minor unit of the currency, required
+	Currency    string    `json:"currency"`             // ISO 4217 code, e.g. "EUR"
+	ValidFrom   string    `json:"valid_from,omitempty"` // YYYY-MM-DD, valid since ever if empty
+	ValidTo     string    `json:"valid_to,omitempty"`   // YYYY-MM-DD included, valid forever if empty
 	Created     time.Time `json:"created"`
 }
 
+// ParkFilter selects and sorts the parks of the list. Zero fields don't filter.
+type ParkFilter struct {
+	Tier          string // Of the price filtered and sorted by, adult by default
+	Currency      string // Leaves out the parks with the price of the tier in another currency
+	MinPriceCents *int   // Leaves out the parks with a lower or unknown price of the tier
+	MaxPriceCents *int   // Leaves out the parks with a higher or unknown price of the tier
+	Sort          string // One of ParkSorts, by id if empty
+}
+
+// Sort orders of the park list
+const (
+	ParkSortName      = "name"
+	ParkSortPrice     = "price"  // Cheapest first, parks without price last
+	ParkSortPriceDesc = "-price" // Most expensive first, parks without price last
+)
+
+// ParkSorts are all the valid sort orders of the park list
+var ParkSorts = []string{ParkSortName, ParkSortPrice, ParkSortPriceDesc}
+
 type ThemePark struct {
-	Id          int          `json:"id"`
-	Name        string       `json:"name"`
-	Description string       `json:"description,omitempty"`
-	Picture     string       `json:"picture"`
-	Latitude    float64      `json:"latitude,omitempty"`
-	Longitude   float64      `json:"longitude,omitempty"`
-	Categories  []Category   `json:"categories,omitempty"`
-	Comments    []Comment    `json:"comments,omitempty"`
-	Attractions []Attraction `json:"attractions,omitempty"`
+	Id          int           `json:"id"`
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"`
+	Picture     string        `json:"picture"`
+	Latitude    float64       `json:"latitude,omitempty"`
+	Longitude   float64       `json:"longitude,omitempty"`
+	Categories  []Category    `json:"categories,omitempty"`
+	Comments    []Comment     `json:"comments,omitempty"`
+	Attractions []Attraction  `json:"attractions,omitempty"`
+	Prices      []TicketPrice `json:"prices,omitempty"` // Valid today, set by the store
 }
@@ -0,0 +1,90 @@
+package themepark
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Passwords are stored in the users.password column as argon2id hashes in the PHC string format:
+//
+//	$argon2id$v=19$m=19456,t=2,p=1$<salt base64>$<hash base64>
+//
+// The parameters live in the string itself, so they can be raised later without breaking the existing hashes.
+// Older rows hold an unsalted SHA-256 hex digest; checkPassword accepts them and asks for a rehash.
+const (
+	argon2Memory  = 19 * 1024 // KiB
+	argon2Time    = 2
+	argon2Threads = 1
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+var errInvalidHash = errors.New("invalid password hash")
+
+// dummyHash is checked against when the user doesn't exist, so the login takes as long as with a wrong password
+// and the response time doesn't tell which emails are registered.
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := hashPassword("dummy password")
+	return hash
+})
+
+// hashPassword returns the argon2id hash of password, with a random salt.
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// checkPassword reports whether password matches the stored hash, and whether the hash should be replaced by
+// a new one from hashPassword because it is a legacy SHA-256 digest or uses older argon2id parameters.
+func checkPassword(password string, hash string) (match bool, rehash bool, err error) {
+	if !strings.HasPrefix(hash, "$") {
+		// Legacy unsalted SHA-256 hex digest
+		digest := sha256.Sum256([]byte(password))
+		match = subtle.ConstantTimeCompare([]byte(hex.EncodeToString(digest[:])), []byte(strings.ToLower(hash))) == 1
+		return match, match, nil
+	}
+
+	var version, memory, time int
+	var threads uint8
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, false, errInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, errInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, false, errInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, errInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, errInvalidHash
+	}
+
+	other := argon2.IDKey([]byte(password), salt, uint32(time), uint32(memory), threads, uint32(len(key)))
+	match = subtle.ConstantTimeCompare(key, other) == 1
+	rehash = match && (memory != argon2Memory || time != argon2Time || threads != argon2Threads || len(key) != argon2KeyLen)
+
+	return match, rehash, nil
+}
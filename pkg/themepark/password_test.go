@@ -0,0 +1,104 @@
+package themepark
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+func TestCheckPassword(t *testing.T) {
+	current, err := hashPassword("snake1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same password hashed with weaker parameters, as if they had been raised since
+	salt := []byte("0123456789abcdef")
+	older := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, 8*1024, 1, 1,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(argon2.IDKey([]byte("snake1234"), salt, 1, 8*1024, 1, argon2KeyLen)))
+
+	const legacy = "178c15232b8899b70ebc1c0e9eee1de80cd5031501a9d9dc1ed31f8077f8313c" // SHA-256 of snake1234
+
+	tests := []struct {
+		name     string
+		password string
+		hash     string
+		match    bool
+		rehash   bool
+		err      bool
+	}{
+		{"current hash", "snake1234", current, true, false, false},
+		{"current hash, wrong password", "snake12345", current, false, false, false},
+		{"older parameters", "snake1234", older, true, true, false},
+		{"older parameters, wrong password", "snake", older, false, false, false},
+		{"legacy SHA-256", "snake1234", legacy, true, true, false},
+		{"legacy SHA-256 in uppercase", "snake1234", strings.ToUpper(legacy), true, true, false},
+		{"legacy SHA-256, wrong password", "Snake1234", legacy, false, false, false},
+		{"other algorithm", "snake1234", "$argon2i$v=19$m=19456,t=2,p=1$c2FsdA$aGFzaA", false, false, true},
+		{"missing parts", "snake1234", "$argon2id$v=19$m=19456,t=2,p=1", false, false, true},
+		{"bad salt", "snake1234", "$argon2id$v=19$m=19456,t=2,p=1$!!!$aGFzaA", false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, rehash, err := checkPassword(tt.password, tt.hash)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, want error %v", err, tt.err)
+			}
+			if match != tt.match || rehash != tt.rehash {
+				t.Errorf("match, rehash = %v, %v, want %v, %v", match, rehash, tt.match, tt.rehash)
+			}
+		})
+	}
+}
+
+func TestHashPasswordSalts(t *testing.T) {
+	first, err := hashPassword("snake1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := hashPassword("snake1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first == second {
+		t.Error("two hashes of the same password are equal, the salt isn't random")
+	}
+	if !strings.HasPrefix(first, "$argon2id$") {
+		t.Errorf("hash = %q, want an argon2id PHC string", first)
+	}
+}
+
+func TestLoginUpgradesLegacyHash(t *testing.T) {
+	s := newTestServer(t)
+
+	// The admin of the test dataset has a legacy SHA-256 hash
+	if hash := s.store.users[1].Password; strings.HasPrefix(hash, "$") {
+		t.Fatalf("hash = %q, want a legacy SHA-256 digest", hash)
+	}
+
+	rec := s.do(http.MethodPost, "/pub/login", "", `{"email": "admin@parkfinder.com", "password": "wrong1234"}`)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status with a wrong password = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if hash := s.store.users[1].Password; strings.HasPrefix(hash, "$") {
+		t.Fatal("a failed login upgraded the hash")
+	}
+
+	s.login("admin@parkfinder.com", "snake1234")
+	upgraded := s.store.users[1].Password
+	if !strings.HasPrefix(upgraded, "$argon2id$") {
+		t.Fatalf("hash after login = %q, want argon2id", upgraded)
+	}
+
+	// The upgraded hash still accepts the password, and isn't upgraded again
+	s.login("admin@parkfinder.com", "snake1234")
+	if s.store.users[1].Password != upgraded {
+		t.Error("the argon2id hash was replaced on the second login")
+	}
+}
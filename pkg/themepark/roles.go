@@ -0,0 +1,46 @@
+package themepark
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// AnyRole are all the access levels, for routes open to every logged in user. Users with an access level
+// not listed here are denied everywhere.
+var AnyRole = []int{AdminAccessLevel, UserAccessLevel, ModeratorAccessLevel}
+
+// RequireRole only lets through users with one of the given access levels. Users without one get a 403,
+// and requests without a user (AuthMiddleware didn't run) a 401.
+func RequireRole(roles ...int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := UserFromContext(r.Context())
+			if !ok {
+				WriteError(w, r, fmt.Errorf("%w: not logged in", ErrUnauthorized))
+				return
+			}
+
+			if !slices.Contains(roles, user.AccessLevel) {
+				WriteError(w, r, fmt.Errorf("%w: not allowed for access level %d", ErrForbidden, user.AccessLevel))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireSelfOrAdmin fails with ErrForbidden unless the caller is the given user or an admin
+func requireSelfOrAdmin(r *http.Request, userID int) error {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		return fmt.Errorf("%w: not logged in", ErrUnauthorized)
+	}
+
+	if user.ID != userID && user.AccessLevel != AdminAccessLevel {
+		return fmt.Errorf("%w: user %d can only be accessed by itself or an admin", ErrForbidden, userID)
+	}
+
+	return nil
+}
@@ -0,0 +1,247 @@
+package themepark
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// RouterOption configures the router built by NewRouter.
+type RouterOption func(*routerOptions)
+
+type routerOptions struct {
+	middlewares  []mux.MiddlewareFunc
+	queryTimeout time.Duration
+	tokenTTL     time.Duration
+	refreshTTL   time.Duration
+
+	signer         *TokenSigner
+	accessTokenTTL time.Duration
+	versions       *TokenVersions
+
+	mailer    Mailer
+	publicURL string
+
+	clientIPHeader string
+}
+
+// WithMiddleware adds middlewares that run before every route, e.g. for logging.
+func WithMiddleware(middlewares ...mux.MiddlewareFunc) RouterOption {
+	return func(o *routerOptions) {
+		o.middlewares = append(o.middlewares, middlewares...)
+	}
+}
+
+// WithQueryTimeout cancels the context of every request after the given time, so slow queries
+// are cancelled instead of piling up. Zero means no timeout.
+func WithQueryTimeout(timeout time.Duration) RouterOption {
+	return func(o *routerOptions) {
+		o.queryTimeout = timeout
+	}
+}
+
+// WithTokenTTL sets how long the tokens returned by the login are valid. Zero means DefaultTokenTTL.
+func WithTokenTTL(ttl time.Duration) RouterOption {
+	return func(o *routerOptions) {
+		o.tokenTTL = ttl
+	}
+}
+
+// WithRefreshTokenTTL sets how long refresh tokens are valid. Zero means DefaultRefreshTokenTTL.
+func WithRefreshTokenTTL(ttl time.Duration) RouterOption {
+	return func(o *routerOptions) {
+		o.refreshTTL = ttl
+	}
+}
+
+// WithTokenSigner makes the login return short-lived signed access tokens, which AuthMiddleware checks
+// without going to the database. Refresh tokens are still stored. Without WithTokenVersions the access
+// tokens can't be revoked and stay valid until they expire.
+func WithTokenSigner(signer *TokenSigner) RouterOption {
+	return func(o *routerOptions) {
+		o.signer = signer
+	}
+}
+
+// WithAccessTokenTTL sets how long signed access tokens are valid. Zero means DefaultAccessTokenTTL.
+func WithAccessTokenTTL(ttl time.Duration) RouterOption {
+	return func(o *routerOptions) {
+		o.accessTokenTTL = ttl
+	}
+}
+
+// WithTokenVersions makes AuthMiddleware reject the signed access tokens revoked in versions. The caller keeps
+// it up to date, see StartTokenVersionRefresh; the handlers that revoke tokens also refresh it.
+func WithTokenVersions(versions *TokenVersions) RouterOption {
+	return func(o *routerOptions) {
+		o.versions = versions
+	}
+}
+
+// WithMailer sets the Mailer of the emails sent by the app. By default they are only logged, with LogMailer.
+func WithMailer(mailer Mailer) RouterOption {
+	return func(o *routerOptions) {
+		o.mailer = mailer
+	}
+}
+
+// WithPublicURL sets the base URL of the API used in the links sent by email, e.g. "https://api.parkfinder.com".
+func WithPublicURL(publicURL string) RouterOption {
+	return func(o *routerOptions) {
+		o.publicURL = publicURL
+	}
+}
+
+// WithClientIPHeader sets the header with the client IP, e.g. "X-Forwarded-For", when the app runs behind a
+// proxy. The failed logins are counted per IP, so without it they would all count for the proxy. Only set it
+// if the proxy always sets the header, otherwise clients can send any IP.
+func WithClientIPHeader(header string) RouterOption {
+	return func(o *routerOptions) {
+		o.clientIPHeader = header
+	}
+}
+
+// NewRouter registers all the routes of the API on top of the given store. It is meant to be built once
+// per process and reused for every request; it is shared by the standalone server and the Vercel handler.
+func NewRouter(store Store, opts ...RouterOption) *mux.Router {
+	var options routerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	handlers := NewHandlers(store)
+	if options.tokenTTL > 0 {
+		handlers.tokenTTL = options.tokenTTL
+	}
+	if options.refreshTTL > 0 {
+		handlers.refreshTokenTTL = options.refreshTTL
+	}
+	handlers.signer = options.signer
+	handlers.versions = options.versions
+	if options.accessTokenTTL > 0 {
+		handlers.accessTokenTTL = options.accessTokenTTL
+	}
+	if options.mailer != nil {
+		handlers.mailer = options.mailer
+	}
+	if options.publicURL != "" {
+		handlers.publicURL = strings.TrimSuffix(options.publicURL, "/")
+	}
+	handlers.clientIPHeader = options.clientIPHeader
+	router := mux.NewRouter()
+	router.Use(RequestIDMiddleware, stripIdentityHeaders)
+	if options.queryTimeout > 0 {
+		router.Use(timeoutMiddleware(options.queryTimeout))
+	}
+	router.Use(options.middlewares...)
+
+	// Public routes
+	pub := router.PathPrefix("/pub").Subrouter()
+	pub.HandleFunc("/login", handlers.SignIn).Methods(http.MethodPost)
+	pub.HandleFunc("/getCategories", handlers.GetCategories).Methods(http.MethodGet)
+	pub.HandleFunc("/register", handlers.AddUser).Methods(http.MethodPost)
+	pub.HandleFunc("/register/resend", handlers.ResendEmailVerification).Methods(http.MethodPost)
+	pub.HandleFunc("/verify-email", handlers.VerifyEmail).Methods(http.MethodGet)
+	pub.HandleFunc("/password/forgot", handlers.ForgotPassword).Methods(http.MethodPost)
+	pub.HandleFunc("/password/reset", handlers.ResetPassword).Methods(http.MethodPost)
+	pub.HandleFunc("/token/refresh", handlers.RefreshToken).Methods(http.MethodPost)
+
+	// Private routes. Every one says which access levels it allows, the rest get a 403.
+	priv := router.PathPrefix("/priv").Subrouter()
+	priv.Use(handlers.AuthMiddleware)
+	allow := func(path string, method string, handler http.HandlerFunc, roles ...int) {
+		priv.Handle(path, RequireRole(roles...)(handler)).Methods(method)
+	}
+	allow("/", http.MethodGet, handlers.ServeHTTP, AnyRole...)
+	allow("/logout", http.MethodPost, handlers.Logout, AnyRole...)
+	allow("/logout/all", http.MethodPost, handlers.LogoutAll, AnyRole...)
+	allow("/me", http.MethodGet, handlers.GetMe, AnyRole...)
+	allow("/me/password", http.MethodPost, handlers.ChangePassword, AnyRole...)
+	allow("/users/{id:[0-9]+}", http.MethodGet, handlers.GetUser, AnyRole...)
+	allow("/users/{id:[0-9]+}", http.MethodPatch, handlers.UpdateUser, AnyRole...)
+	allow("/users/{id:[0-9]+}/role", http.MethodPut, handlers.SetUserRole, AdminAccessLevel)
+	allow("/users/{id:[0-9]+}/role", http.MethodGet, handlers.GetRoleChanges, AdminAccessLevel)
+	allow("/parks", http.MethodGet, handlers.GetParks, AnyRole...)
+	allow("/parks", http.MethodPost, handlers.InsertThemePark, AdminAccessLevel)
+	allow("/park/{id:[0-9]+}", http.MethodGet, handlers.GetParkDetails, AnyRole...)
+	allow("/park/{id:[0-9]+}", http.MethodDelete, handlers.DeleteThemePark, AdminAccessLevel)
+	allow("/park/{id:[0-9]+}", http.MethodPatch, handlers.UpdateThemePark, AdminAccessLevel, ModeratorAccessLevel)
+	allow("/park/{id:[0-9]+}/attractions", http.MethodGet, handlers.GetParkAttractions, AnyRole...)
+	allow("/park/{id:[0-9]+}/attractions", http.MethodPost, handlers.AddAttraction, AdminAccessLevel, ModeratorAccessLevel)
+	allow("/park/{id:[0-9]+}/attractions/{attractionId:[0-9]+}", http.MethodGet, handlers.GetAttraction, AnyRole...)
+	allow("/park/{id:[0-9]+}/attractions/{attractionId:[0-9]+}", http.MethodPatch, handlers.UpdateAttraction, AdminAccessLevel, ModeratorAccessLevel)
+	allow("/park/{id:[0-9]+}/attractions/{attractionId:[0-9]+}", http.MethodDelete, handlers.DeleteAttraction, AdminAccessLevel)
+	allow("/park/{id:[0-9]+}/attractions/{attractionId:[0-9]+}/wait-times", http.MethodGet, handlers.GetWaitTimes, AnyRole...)
+	allow("/park/{id:[0-9]+}/attractions/{attractionId:[0-9]+}/wait-times", http.MethodPost, handlers.ReportWaitTime, AnyRole...)
+	allow("/park/{id:[0-9]+}/prices", http.MethodGet, handlers.GetParkTicketPrices, AnyRole...)
+	allow("/park/{id:[0-9]+}/prices", http.MethodPost, handlers.AddTicketPrice, AdminAccessLevel)
+	allow("/park/{id:[0-9]+}/prices/{priceId:[0-9]+}", http.MethodGet, handlers.GetTicketPrice, AnyRole...)
+	allow("/park/{id:[0-9]+}/prices/{priceId:[0-9]+}", http.MethodPatch, handlers.UpdateTicketPrice, AdminAccessLevel)
+	allow("/park/{id:[0-9]+}/prices/{priceId:[0-9]+}", http.MethodDelete, handlers.DeleteTicketPrice, AdminAccessLevel)
+	allow("/park/{id:[0-9]+}/calendar", http.MethodGet, handlers.GetParkCalendar, AnyRole...)
+	allow("/park/{id:[0-9]+}/calendar", http.MethodPut, handlers.SetParkCalendar, AdminAccessLevel, ModeratorAccessLevel)
+	allow("/park/{id:[0-9]+}/calendar.ics", http.MethodGet, handlers.GetParkICS, AnyRole...)
+	allow("/park/{id:[0-9]+}/schedule", http.MethodGet, handlers.GetParkSchedule, AnyRole...)
+	allow("/park/{id:[0-9]+}/open", http.MethodGet, handlers.GetParkOpen, AnyRole...)
+	allow("/park/comments", http.MethodPost, handlers.InsertParkComment, AnyRole...)
+	allow("/categories", http.MethodPost, handlers.AddCategory, AdminAccessLevel, ModeratorAccessLevel)
+	allow("/users", http.MethodGet, handlers.GetAllUsers, AdminAccessLevel)
+	allow("/stats/database", http.MethodGet, handlers.GetDatabaseStats, AdminAccessLevel)
+
+	// Not found routes. The router middlewares only run for matched routes, so add the request id here too.
+	router.NotFoundHandler = RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if methods := allowedMethods(router, r); len(methods) > 0 {
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			WriteError(w, r, fmt.Errorf("%w: %s %s", ErrMethodNotAllowed, r.Method, r.URL.Path))
+			return
+		}
+
+		log.Printf("Route not found: %s", r.URL.Path)
+		WriteError(w, r, fmt.Errorf("route %s: %w", r.URL.Path, ErrNotFound))
+	}))
+	router.MethodNotAllowedHandler = RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", strings.Join(allowedMethods(router, r), ", "))
+		WriteError(w, r, fmt.Errorf("%w: %s %s", ErrMethodNotAllowed, r.Method, r.URL.Path))
+	}))
+
+	return router
+}
+
+// timeoutMiddleware adds a deadline to the request context, which the store uses for its queries.
+func timeoutMiddleware(timeout time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// allowedMethods returns the methods with a route for the path of the request. Subrouters with several
+// routes make gorilla/mux report a 404 instead of a 405 for a wrong method, so the not found handler
+// uses this to tell both cases apart.
+func allowedMethods(router *mux.Router, r *http.Request) []string {
+	var methods []string
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		if method == r.Method {
+			continue
+		}
+
+		req := r.Clone(r.Context())
+		req.Method = method
+
+		var match mux.RouteMatch
+		if router.Match(req, &match) && match.MatchErr == nil {
+			methods = append(methods, method)
+		}
+	}
+
+	return methods
+}
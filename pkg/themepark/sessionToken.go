@@ -0,0 +1,14 @@
+package themepark
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// hashToken returns the SHA-256 hex digest of a session token, which is what the stores keep, so a leaked
+// tokens table can't be used to log in. Tokens are random UUIDs, so a fast unsalted hash is enough here,
+// unlike for passwords.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,155 @@
+package themepark
+
+import "time"
+
+// LoadTestDataset inserts the test dataset from database.sql into the store.
+// Keep both in sync when the dataset changes.
+func (m *MemoryStore) LoadTestDataset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	themeParks := []ThemePark{
+		{Id: 1, Name: "Parque de atracciones de Madrid", Latitude: 40.412021843909045, Longitude: -3.7493498990303147, Description: "Parque propiedad del ayuntamiento de Madrid", Picture: "https://www.transfersandexperiences.com/images/actividades/1027/parque-de-atracciones-madrid.jpg"},
+		{Id: 2, Name: "Parque Warner de Madrid", Latitude: 40.23184478750921, Longitude: -3.5925680021535955, Description: "Parque temático con personajes de Warner Bros studios", Picture: "https://www.transfersandexperiences.com/images/actividades/1025/parque-warner-madrid.jpeg"},
+		{Id: 3, Name: "Port Aventura", Latitude: 41.09350804068493, Longitude: 1.1611417895801308, Description: "El mejor parque de atracciones y temático de España", Picture: "https://image.jimcdn.com/app/cms/image/transf/dimension=778x10000:format=jpg/path/seb53d1550d7485e8/image/ibcb2924f48a1dfee/version/1638261919/entradas-port-aventura.jpg"},
+	}
+	for _, themePark := range themeParks {
+		m.themeParks[themePark.Id] = themePark
+		m.timeZones[themePark.Id] = "Europe/Madrid"
+		m.setID("themeparks", themePark.Id)
+	}
+
+	categories := []Category{
+		{Id: 1, Name: "Emoción"},
+		{Id: 2, Name: "Familiar"},
+		{Id: 3, Name: "Niños"},
+		{Id: 4, Name: "Relax"},
+	}
+	for _, category := range categories {
+		category.Created = now
+		m.categories[category.Id] = category
+		m.setID("categories", category.Id)
+	}
+
+	themeParkCategories := []ThemeparkCategory{
+		{Id: 1, ThemeparkId: 1, CategoryId: 1}, // PAM has all categories (Trilling, Family friendly, Children and Relaxing)
+		{Id: 2, ThemeparkId: 1, CategoryId: 2},
+		{Id: 3, ThemeparkId: 1, CategoryId: 3},
+		{Id: 4, ThemeparkId: 1, CategoryId: 4},
+		{Id: 5, ThemeparkId: 2, CategoryId: 1}, // Warner only 1 (thrilling) and 2 (Family friendly)
+		{Id: 6, ThemeparkId: 2, CategoryId: 2},
+		{Id: 7, ThemeparkId: 3, CategoryId: 1}, // Port Aventura only 1 (thrilling)
+	}
+	for _, themeParkCategory := range themeParkCategories {
+		themeParkCategory.Created = now
+		m.themeParkCategories = append(m.themeParkCategories, themeParkCategory)
+		m.setID("themeparks_categories", themeParkCategory.Id)
+	}
+
+	attractions := []Attraction{
+		{Id: 1, ThemeparkId: 1, Name: "La lanzadera", Type: AttractionTypeDropTower, MinHeight: ptr(140), ThrillLevel: ptr(5)}, // Belongs to PAM
+		{Id: 2, ThemeparkId: 1, Name: "El tornado", Type: AttractionTypeCoaster, MinHeight: ptr(120), ThrillLevel: ptr(4)},     // Belongs to PAM
+		{Id: 3, ThemeparkId: 2, Name: "Stunt Fall", Type: AttractionTypeCoaster, MinHeight: ptr(122), ThrillLevel: ptr(5)},     // Belongs to Warner
+		{Id: 4, ThemeparkId: 2, Name: "Batman returns", Type: AttractionTypeCoaster, MinHeight: ptr(120), ThrillLevel: ptr(4)}, // Belongs to Warner
+		{Id: 5, ThemeparkId: 3, Name: "Shambala", Type: AttractionTypeCoaster, MinHeight: ptr(140), ThrillLevel: ptr(5)},       // Belongs to Port Aventura
+		{Id: 6, ThemeparkId: 3, Name: "Dragon Khan", Type: AttractionTypeCoaster, MinHeight: ptr(140), ThrillLevel: ptr(5)},    // Belongs to Port Aventura
+	}
+	for _, attraction := range attractions {
+		attraction.Status = AttractionStatusOpen
+		attraction.Created = now
+		m.attractions[attraction.Id] = attraction
+		m.setID("attractions", attraction.Id)
+	}
+
+	// PAM opens Friday to Sunday and closes on Christmas, Port Aventura opens every day and closes early on Christmas Eve
+	m.calendars[1] = ParkCalendar{
+		Weekly: []WeeklyHours{
+			{Weekday: "sunday", Opens: "11:00", Closes: "21:00"},
+			{Weekday: "friday", Opens: "12:00", Closes: "22:00"},
+			{Weekday: "saturday", Opens: "11:00", Closes: "23:00"},
+		},
+		Exceptions: []DateHours{
+			{Date: "2024-12-25", Closed: true, Note: "Cerrado por Navidad"},
+		},
+	}
+	m.calendars[3] = ParkCalendar{
+		Weekly: []WeeklyHours{
+			{Weekday: "sunday", Opens: "10:00", Closes: "20:00"},
+			{Weekday: "monday", Opens: "10:00", Closes: "20:00"},
+			{Weekday: "tuesday", Opens: "10:00", Closes: "20:00"},
+			{Weekday: "wednesday", Opens: "10:00", Closes: "20:00"},
+			{Weekday: "thursday", Opens: "10:00", Closes: "20:00"},
+			{Weekday: "friday", Opens: "10:00", Closes: "24:00"},
+			{Weekday: "saturday", Opens: "10:00", Closes: "24:00"},
+		},
+		Exceptions: []DateHours{
+			{Date: "2024-12-24", Opens: "10:00", Closes: "17:00", Note: "Nochebuena"},
+		},
+	}
+
+	ticketPrices := []TicketPrice{
+		{Id: 1, ThemeparkId: 1, Tier: TicketTierAdult, AmountCents: ptr(3990), Currency: "EUR"}, // PAM
+		{Id: 2, ThemeparkId: 1, Tier: TicketTierChild, AmountCents: ptr(3190), Currency: "EUR"},
+		{Id: 3, ThemeparkId: 1, Tier: TicketTierSenior, AmountCents: ptr(990), Currency: "EUR"},
+		{Id: 4, ThemeparkId: 2, Tier: TicketTierAdult, AmountCents: ptr(4900), Currency: "EUR"}, // Warner
+		{Id: 5, ThemeparkId: 2, Tier: TicketTierChild, AmountCents: ptr(4100), Currency: "EUR"},
+		{Id: 6, ThemeparkId: 3, Tier: TicketTierAdult, AmountCents: ptr(6000), Currency: "EUR"}, // Port Aventura
+		{Id: 7, ThemeparkId: 3, Tier: TicketTierChild, AmountCents: ptr(5200), Currency: "EUR"},
+		{Id: 8, ThemeparkId: 3, Tier: TicketTierSeasonPass, AmountCents: ptr(19900), Currency: "EUR"},
+	}
+	for _, price := range ticketPrices {
+		price.Created = now
+		m.ticketPrices[price.Id] = price
+		m.setID("ticket_prices", price.Id)
+	}
+
+	users := []User{
+		{ID: 1, Name: "Admin", Email: "admin@parkfinder.com", Password: "178c15232b8899b70ebc1c0e9eee1de80cd5031501a9d9dc1ed31f8077f8313c", AccessLevel: 1, BirthDate: date(1991, 10, 31), City: "Alaska City", ProfilePicture: "https://encrypted-tbn0.gstatic.com/images?q=tbn:ANd9GcQa7XyNBEPCmS9ExVaSd7c3tyLVYey536a3Bw&s", Description: "Me gustan los parques de atraciones y las montañas rusas!!"},                           // password is snake1234
+		{ID: 2, Name: "Revolver Occelot", Email: "revolver.occelote@konami.jp", Password: "ea5e443277359401ae943262d5d99c51743e2b2093b5c58340e859ce5809618a", AccessLevel: 2, BirthDate: date(1966, 2, 21), City: "Moscow", ProfilePicture: "https://image.civitai.com/xG1nkqKTMzGDvpLrqFT7WA/3af0e904-f03f-42e0-af2f-ae044fefa370/original=true,quality=90/dVykdLx0pwlQlCo7_WzFs.jpeg", Description: "Buscando parques familiares"}, // password is ocelote1234
+		{ID: 3, Name: "Meryl Silverburgh", Email: "meryl.silverburgh@konami.jp", Password: "85f7280ad47598661a220198e63d91836ecb5c5780eab94707e92bf299572b49", AccessLevel: 2, BirthDate: date(1994, 9, 1), City: "Paris", ProfilePicture: "https://image.civitai.com/xG1nkqKTMzGDvpLrqFT7WA/de899f50-7d1c-4460-bfa8-2dca60b05b2a/width=450/00372-1034797549.jpeg", Description: "Hola!!! "},                                         // password is meryl1234
+	}
+	for _, user := range users {
+		user.EmailVerified = true
+		m.users[user.ID] = user
+		m.setID("users", user.ID)
+	}
+
+	usersCategories := []UsersCategory{
+		{Id: 1, UserId: 1, CategoryId: 1}, // Solid Snake loves Trilling, Family friendly and Children theme parks
+		{Id: 2, UserId: 1, CategoryId: 2},
+		{Id: 3, UserId: 1, CategoryId: 3},
+		{Id: 4, UserId: 2, CategoryId: 1}, // Revolver Occelot loves Trilling and Family friendly theme parks
+		{Id: 5, UserId: 2, CategoryId: 2},
+		{Id: 6, UserId: 3, CategoryId: 4}, // Meryl Silverburgh loves only Relaxing
+	}
+	for _, userCategory := range usersCategories {
+		userCategory.Created = now
+		m.usersCategories = append(m.usersCategories, userCategory)
+		m.setID("users_categories", userCategory.Id)
+	}
+
+	comments := []Comment{
+		{Id: 1, UserId: 1, ThemeparkId: 1, Comment: "Me encanta la lanzadera, la adrenalina es lo más"},                // Solid Snake de PAM
+		{Id: 2, UserId: 1, ThemeparkId: 1, Comment: "Los fiordos son muy aburridos, aunque te mojas un montón"},        // Solid Snake de PAM
+		{Id: 3, UserId: 2, ThemeparkId: 2, Comment: "La nueva de batman es mi favorita"},                               // Revolver Occelot de Warner
+		{Id: 4, UserId: 2, ThemeparkId: 3, Comment: "Siempre hay mucha gente"},                                         // Revolver Occelot de port aventura
+		{Id: 5, UserId: 3, ThemeparkId: 2, Comment: "Evitad ir en verano, las temperaturas supertan los 40 grados :S"}, // Meryl Silverburgh de Warner
+		{Id: 6, UserId: 3, ThemeparkId: 3, Comment: "Mi parque temático favorito de España"},                           // Meryl Silverburgh de Port aventura
+		{Id: 7, UserId: 1, ThemeparkId: 3, Comment: "Ferrari-Land es una pasada"},                                      // Solid Snake de Port aventura
+	}
+	for _, comment := range comments {
+		comment.Created = now
+		m.comments[comment.Id] = comment
+		m.setID("comments", comment.Id)
+	}
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
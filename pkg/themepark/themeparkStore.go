@@ -1,21 +1,84 @@
 package themepark
 
+import (
+	"context"
+	"time"
+)
+
+// Store is the persistence layer of the app. Every method takes the context of the request, so queries
+// are cancelled when the client goes away or the query timeout expires.
 type Store interface {
-	AddUser(user User) error
-	GetUser(userID int) (*User, error)
-	GetAllUsers() ([]User, error) // Only for admin users
-	UpdateUser(user User) error
-	AddThemePark(themePark ThemePark) error    // Only for admin users
-	UpdateThemePark(themePark ThemePark) error // Only for admin users
-	DeleteThemePark(id int) error              // Only for admin users
-	GetAllThemeParks() ([]ThemePark, error)
-	GetThemeParkDetail(parkID int) (*ThemePark, error)
-	InsertParkComment(parkID int, userId int, comment string) error
-	AddCategory(name string) error
-	GetAllCategories() ([]Category, error)
+	AddUser(ctx context.Context, user User) error // Always a normal user, see SetUserAccessLevel
+	GetUser(ctx context.Context, userID int) (*User, error)
+	GetAllUsers(ctx context.Context) ([]User, error) // Only for admin users
+	UpdateUser(ctx context.Context, user User) error
+	SetUserAccessLevel(ctx context.Context, userID int, accessLevel int, changedBy int) error // Only for admin users, records a RoleChange and bumps the token version
+	GetRoleChanges(ctx context.Context, userID int) ([]RoleChange, error)                     // Only for admin users
+	AddThemePark(ctx context.Context, themePark ThemePark) error                              // Only for admin users
+	UpdateThemePark(ctx context.Context, themePark ThemePark) error                           // Only for admin users
+	DeleteThemePark(ctx context.Context, id int) error                                        // Only for admin users
+	// GetAllThemeParks returns the parks that pass the filter, in its order, with their prices valid today
+	GetAllThemeParks(ctx context.Context, filter ParkFilter) ([]ThemePark, error)
+	GetThemeParkDetail(ctx context.Context, parkID int, filter AttractionFilter) (*ThemePark, error) // Only the attractions that pass the filter
+	InsertParkComment(ctx context.Context, parkID int, userId int, comment string) error
+	// Attractions always belong to a park: the ones of another park fail with ErrNotFound
+	GetParkAttractions(ctx context.Context, parkID int, filter AttractionFilter) ([]Attraction, error)
+	GetAttraction(ctx context.Context, parkID int, attractionID int) (*Attraction, error)
+	AddAttraction(ctx context.Context, attraction Attraction) (int, error)    // Only for admins and moderators, returns the new id
+	UpdateAttraction(ctx context.Context, attraction Attraction) error        // Only for admins and moderators
+	DeleteAttraction(ctx context.Context, parkID int, attractionID int) error // Only for admin users
+	AddWaitTimeReport(ctx context.Context, parkID int, report WaitTimeReport) error
+	// GetWaitTimes returns the wait times of an attraction, nil without reports. ErrNotFound if it isn't of the park.
+	GetWaitTimes(ctx context.Context, parkID int, attractionID int) (*WaitTimes, error)
+	// GetParkCalendar returns the opening hours of a park, in UTC and always closed if they were never set
+	GetParkCalendar(ctx context.Context, parkID int) (*ParkCalendar, error)
+	SetParkCalendar(ctx context.Context, parkID int, calendar ParkCalendar) error // Replaces the whole calendar and time zone
+	// Ticket prices always belong to a park: the ones of another park fail with ErrNotFound. Prices of a tier
+	// valid on the same dates as another one fail with ErrConflict.
+	GetParkTicketPrices(ctx context.Context, parkID int) ([]TicketPrice, error) // All of them, also past and future ones
+	GetTicketPrice(ctx context.Context, parkID int, priceID int) (*TicketPrice, error)
+	AddTicketPrice(ctx context.Context, price TicketPrice) (int, error)   // Only for admin users, returns the new id
+	UpdateTicketPrice(ctx context.Context, price TicketPrice) error       // Only for admin users
+	DeleteTicketPrice(ctx context.Context, parkID int, priceID int) error // Only for admin users
+	AddCategory(ctx context.Context, name string) error
+	GetAllCategories(ctx context.Context) ([]Category, error)
 	//RemoveCategory() error
-	// SignIn returns a token if ok, error if nok
-	SignIn(userName string, userPass string) (string, int, error) // Token, userId, error
-	// IsLoggedIn given a token, returns if the user is logged in, the user ID and the admin level (1 Admin, 2 normal user).
-	IsLoggedIn(token string) (bool, int, int)
+	// CreateEmailVerification returns a one-time token, valid for ttl, to verify the email of a new user.
+	// Fails with ErrNotFound for unknown emails and ErrConflict if the email is already verified.
+	CreateEmailVerification(ctx context.Context, email string, ttl time.Duration) (string, error)
+	VerifyEmail(ctx context.Context, token string) error // Uses up the token, ErrNotFound if it is invalid or expired
+	// ChangePassword sets a new password if the current one matches, logging the user out everywhere.
+	// A wrong current password fails with ErrUnauthorized.
+	ChangePassword(ctx context.Context, userID int, currentPassword string, newPassword string) error
+	// CreatePasswordReset returns a one-time token, valid for ttl, to reset the password. ErrNotFound for unknown emails.
+	CreatePasswordReset(ctx context.Context, email string, ttl time.Duration) (string, error)
+	// ResetPassword uses up a password reset token to set a new password, logging the user out everywhere.
+	// ErrNotFound if the token is invalid or expired.
+	ResetPassword(ctx context.Context, token string, newPassword string) error
+	// CountUserTokens returns how many one-time tokens with the given purpose were created for the email since the given time
+	CountUserTokens(ctx context.Context, email string, purpose string, since time.Time) (int, error)
+	// LoginLockedUntil returns until when logins are locked for any of the keys, or the zero time if they aren't
+	LoginLockedUntil(ctx context.Context, keys ...string) (time.Time, error)
+	// RecordLoginFailure counts a failed login for the key, locking it as the throttle says. Returns until when it is locked.
+	RecordLoginFailure(ctx context.Context, key string, throttle LoginThrottle) (time.Time, error)
+	ResetLoginFailures(ctx context.Context, key string) error // After a successful login
+	// SignIn starts a session, only for users with a verified email, with an access token and a refresh token if ok,
+	// error if nok. Unknown emails and wrong passwords fail with the same ErrUnauthorized.
+	SignIn(ctx context.Context, userName string, userPass string, ttl SessionTTL) (Session, error)
+	// RefreshSession rotates a refresh token, returning new tokens of the same session. Using an already rotated
+	// refresh token means it leaked, so the whole session is revoked and it fails with ErrUnauthorized.
+	RefreshSession(ctx context.Context, refreshToken string, ttl SessionTTL) (Session, error)
+	// IsLoggedIn given an access token, returns if the user is logged in, the user ID and the admin level (1 Admin, 2 normal user, 3 park moderator).
+	// Expired tokens are not logged in.
+	IsLoggedIn(ctx context.Context, token string) (bool, int, int)
+	// DeleteSession logs out, deleting all the tokens of the session of the token. Tokens of another user fail with
+	// ErrNotFound, like unknown ones.
+	DeleteSession(ctx context.Context, userID int, token string) error
+	DeleteUserTokens(ctx context.Context, userID int) error // Log out everywhere, bumping the token version
+	// GetTokenVersion returns the version signed into the access tokens of the user. Bumping it revokes the
+	// access tokens signed before.
+	GetTokenVersion(ctx context.Context, userID int) (int, error)
+	// GetRevokedTokenVersions returns the token version of the users whose version was bumped since the given time
+	GetRevokedTokenVersions(ctx context.Context, since time.Time) (map[int]int, error)
+	DeleteExpiredTokens(ctx context.Context) (int64, error) // Returns how many were deleted
 }
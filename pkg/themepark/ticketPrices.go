@@ -0,0 +1,182 @@
+package themepark
+
+import (
+	"cmp"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// validOn returns whether the price is valid on the date, as YYYY-MM-DD, which compares as text
+func (p TicketPrice) validOn(date string) bool {
+	return (p.ValidFrom == "" || p.ValidFrom <= date) && (p.ValidTo == "" || date <= p.ValidTo)
+}
+
+// overlaps returns whether both prices are of the same tier and valid on a same date
+func (p TicketPrice) overlaps(other TicketPrice) bool {
+	return p.Tier == other.Tier &&
+		(p.ValidFrom == "" || other.ValidTo == "" || p.ValidFrom <= other.ValidTo) &&
+		(p.ValidTo == "" || other.ValidFrom == "" || other.ValidFrom <= p.ValidTo)
+}
+
+// sortTicketPrices sorts prices by tier, as in TicketTiers, and then by the date they are valid from
+func sortTicketPrices(prices []TicketPrice) {
+	slices.SortFunc(prices, func(a, b TicketPrice) int {
+		return cmp.Or(
+			cmp.Compare(slices.Index(TicketTiers, a.Tier), slices.Index(TicketTiers, b.Tier)),
+			cmp.Compare(a.ValidFrom, b.ValidFrom),
+			cmp.Compare(a.Id, b.Id),
+		)
+	})
+}
+
+// currentPrices returns the prices valid today in the time zone of the park, sorted
+func currentPrices(prices []TicketPrice, timeZone string, now time.Time) []TicketPrice {
+	today := now.In(ParkCalendar{TimeZone: timeZone}.location()).Format(dateLayout)
+
+	var current []TicketPrice
+	for _, price := range prices {
+		if price.validOn(today) {
+			current = append(current, price)
+		}
+	}
+	sortTicketPrices(current)
+
+	return current
+}
+
+// price returns the current price of the tier of the filter, nil if the park has none
+func (f ParkFilter) price(themePark ThemePark) *TicketPrice {
+	tier := cmp.Or(f.Tier, TicketTierAdult)
+	for _, price := range themePark.Prices {
+		if price.Tier == tier {
+			return &price
+		}
+	}
+
+	return nil
+}
+
+// Matches returns whether the park passes the filter. Both stores filter with it, so they agree.
+// Amounts are only compared within the currency of the filter, which parseParkFilter requires for them.
+func (f ParkFilter) Matches(themePark ThemePark) bool {
+	if f.Currency == "" && f.MinPriceCents == nil && f.MaxPriceCents == nil {
+		return true
+	}
+
+	price := f.price(themePark)
+	if price == nil || price.AmountCents == nil {
+		return false
+	}
+	if f.Currency != "" && price.Currency != f.Currency {
+		return false
+	}
+	if f.MinPriceCents != nil && *price.AmountCents < *f.MinPriceCents {
+		return false
+	}
+	if f.MaxPriceCents != nil && *price.AmountCents > *f.MaxPriceCents {
+		return false
+	}
+
+	return true
+}
+
+// filterParks returns the parks, with their current prices, that pass the filter in its sort order
+func filterParks(themeParks []ThemePark, filter ParkFilter) []ThemePark {
+	var filtered []ThemePark
+	for _, themePark := range themeParks {
+		if filter.Matches(themePark) {
+			filtered = append(filtered, themePark)
+		}
+	}
+
+	amount := func(themePark ThemePark) *int {
+		if price := filter.price(themePark); price != nil {
+			return price.AmountCents
+		}
+		return nil
+	}
+
+	slices.SortStableFunc(filtered, func(a, b ThemePark) int {
+		switch filter.Sort {
+		case ParkSortName:
+			return cmp.Or(strings.Compare(a.Name, b.Name), cmp.Compare(a.Id, b.Id))
+		case ParkSortPrice, ParkSortPriceDesc:
+			amountA, amountB := amount(a), amount(b)
+			// Parks without price go last in both orders
+			switch {
+			case amountA == nil && amountB == nil:
+				return cmp.Compare(a.Id, b.Id)
+			case amountA == nil:
+				return 1
+			case amountB == nil:
+				return -1
+			}
+			byPrice := cmp.Compare(*amountA, *amountB)
+			if filter.Sort == ParkSortPriceDesc {
+				byPrice = -byPrice
+			}
+			return cmp.Or(byPrice, cmp.Compare(a.Id, b.Id))
+		default:
+			return cmp.Compare(a.Id, b.Id)
+		}
+	})
+
+	return filtered
+}
+
+// parseParkFilter reads a ParkFilter from the query parameters tier, currency, min_price_cents, max_price_cents and sort
+func parseParkFilter(query url.Values) (ParkFilter, error) {
+	var filter ParkFilter
+	var v validator
+
+	filter.Tier = query.Get("tier")
+	v.check(filter.Tier == "" || slices.Contains(TicketTiers, filter.Tier), "tier", "must be one of "+strings.Join(TicketTiers, ", "))
+	filter.Currency = strings.ToUpper(query.Get("currency"))
+	v.check(filter.Currency == "" || validCurrency(filter.Currency), "currency", "must be an ISO 4217 code, e.g. EUR")
+	filter.MinPriceCents = queryCents(&v, query, "min_price_cents")
+	filter.MaxPriceCents = queryCents(&v, query, "max_price_cents")
+	if filter.MinPriceCents != nil && filter.MaxPriceCents != nil {
+		v.check(*filter.MinPriceCents <= *filter.MaxPriceCents, "max_price_cents", "must not be lower than min_price_cents")
+	}
+	filter.Sort = query.Get("sort")
+	v.check(filter.Sort == "" || slices.Contains(ParkSorts, filter.Sort), "sort", "must be one of "+strings.Join(ParkSorts, ", "))
+
+	// Amounts in different currencies can't be compared
+	byPrice := filter.MinPriceCents != nil || filter.MaxPriceCents != nil ||
+		filter.Sort == ParkSortPrice || filter.Sort == ParkSortPriceDesc
+	v.check(!byPrice || filter.Currency != "", "currency", "is required to filter or sort by price")
+
+	return filter, v.err()
+}
+
+// queryCents returns a price query parameter in cents, or nil if it isn't set
+func queryCents(v *validator, query url.Values, name string) *int {
+	if !query.Has(name) {
+		return nil
+	}
+
+	price, err := strconv.Atoi(query.Get(name))
+	v.check(err == nil && price >= 0, name, "must be a positive amount in cents, e.g. 4990")
+	if err != nil {
+		return nil
+	}
+
+	return &price
+}
+
+// validCurrency returns whether the code looks like an ISO 4217 currency code: three uppercase letters
+func validCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,96 @@
+package themepark
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestTicketPriceOverlap(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.login("admin@parkfinder.com", "snake1234").AccessToken
+
+	// The seed has adult, child and senior prices for park 1 without dates, so they are always valid
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"same tier", `{"tier": "adult", "amount_cents": 4500, "currency": "EUR", "valid_from": "2030-01-01"}`, http.StatusConflict},
+		{"tier without prices", `{"tier": "season_pass", "amount_cents": 14900, "currency": "EUR", "valid_to": "2030-12-31"}`, http.StatusCreated},
+		{"overlapping the new price", `{"tier": "season_pass", "amount_cents": 15900, "currency": "EUR", "valid_from": "2030-12-31"}`, http.StatusConflict},
+		{"after the new price", `{"tier": "season_pass", "amount_cents": 15900, "currency": "EUR", "valid_from": "2031-01-01"}`, http.StatusCreated},
+		{"amount with decimals", `{"tier": "season_pass", "amount_cents": 159.90, "currency": "EUR"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(http.MethodPost, "/priv/park/1/prices", admin, tt.body)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
+
+func TestParkPriceFilters(t *testing.T) {
+	s := newTestServer(t)
+	user := s.login("revolver.occelote@konami.jp", "ocelote1234").AccessToken
+
+	// Adult prices of the seed: park 1 3990, park 2 4900 and park 3 6000 EUR cents. Only park 1 has a senior price.
+	tests := []struct {
+		query string
+		ids   []int
+	}{
+		{"max_price_cents=5000&currency=EUR", []int{1, 2}},
+		{"min_price_cents=4900&currency=EUR&sort=-price", []int{3, 2}},
+		{"min_price_cents=4000&max_price_cents=5000&currency=eur", []int{2}},
+		{"tier=senior&currency=EUR&sort=price", []int{1}},
+		{"currency=EUR&sort=price", []int{1, 2, 3}},
+		{"max_price_cents=5000&currency=USD", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := s.do(http.MethodGet, "/priv/parks?"+tt.query, user, "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+
+			var ids []int
+			for _, themePark := range decodeBody[[]ThemePark](t, rec) {
+				ids = append(ids, themePark.Id)
+			}
+			if !slices.Equal(ids, tt.ids) {
+				t.Errorf("parks = %v, want %v", ids, tt.ids)
+			}
+		})
+	}
+}
+
+func TestParkPriceFiltersNeedCurrency(t *testing.T) {
+	s := newTestServer(t)
+	user := s.login("revolver.occelote@konami.jp", "ocelote1234").AccessToken
+
+	tests := []struct {
+		query string
+		field string
+	}{
+		{"max_price_cents=5000", "currency"},
+		{"min_price_cents=1000", "currency"},
+		{"sort=-price", "currency"},
+		{"min_price_cents=5000&max_price_cents=4000&currency=EUR", "max_price_cents"},
+		{"max_price_cents=49.90&currency=EUR", "max_price_cents"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := s.do(http.MethodGet, "/priv/parks?"+tt.query, user, "")
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusUnprocessableEntity, rec.Body)
+			}
+
+			details := decodeBody[errorResponse](t, rec).Details
+			if len(details) != 1 || details[0].Field != tt.field {
+				t.Errorf("details = %v, want one about %s", details, tt.field)
+			}
+		})
+	}
+}
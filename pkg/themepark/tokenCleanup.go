@@ -0,0 +1,38 @@
+package themepark
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// StartTokenCleanup deletes the expired tokens of the store every interval, until ctx is cancelled.
+// The tokens are rejected as soon as they expire; this only keeps the tokens table from growing forever.
+// An interval of 0 or less disables the cleanup.
+func StartTokenCleanup(ctx context.Context, store Store, interval time.Duration) {
+	if interval <= 0 {
+		log.Printf("Expired token cleanup disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				deleted, err := store.DeleteExpiredTokens(ctx)
+				if err != nil {
+					log.Printf("Error deleting expired tokens: %v", err)
+					continue
+				}
+				if deleted > 0 {
+					log.Printf("Deleted %d expired tokens", deleted)
+				}
+			}
+		}
+	}()
+}
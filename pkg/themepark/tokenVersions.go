@@ -0,0 +1,75 @@
+package themepark
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// TokenVersions is an in-process copy of the token versions of the users whose signed access tokens were revoked
+// recently, so AuthMiddleware can reject them without going to the database on every request. Revocations older
+// than the access token TTL aren't kept, because every token signed before them has expired already.
+// It is safe for concurrent use.
+type TokenVersions struct {
+	store Store
+	ttl   time.Duration
+
+	mu       sync.RWMutex
+	versions map[int]int // user id -> token version, only for users revoked in the last TTL
+}
+
+// NewTokenVersions returns an empty TokenVersions for access tokens valid for accessTokenTTL. It only knows about
+// revocations once refreshed, see Refresh and StartTokenVersionRefresh.
+func NewTokenVersions(store Store, accessTokenTTL time.Duration) *TokenVersions {
+	if accessTokenTTL <= 0 {
+		accessTokenTTL = DefaultAccessTokenTTL
+	}
+
+	return &TokenVersions{store: store, ttl: accessTokenTTL, versions: map[int]int{}}
+}
+
+// Refresh reloads the token versions of the users revoked in the last TTL, twice over to leave room for clock
+// skew between the servers and the database
+func (v *TokenVersions) Refresh(ctx context.Context) error {
+	versions, err := v.store.GetRevokedTokenVersions(ctx, time.Now().Add(-2*v.ttl))
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	v.versions = versions
+	v.mu.Unlock()
+
+	return nil
+}
+
+// Revoked tells whether an access token of the user with the given version has been revoked
+func (v *TokenVersions) Revoked(userID int, version int) bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	current, ok := v.versions[userID]
+	return ok && version < current
+}
+
+// StartTokenVersionRefresh refreshes the token versions right away and then every interval, until ctx is cancelled.
+// Other servers learn about a revocation within the interval; the one that made it refreshes straight away.
+func StartTokenVersionRefresh(ctx context.Context, versions *TokenVersions, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := versions.Refresh(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Error refreshing token versions: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,40 @@
+package themepark
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenVersionsKeepOnlyRecentRevocations(t *testing.T) {
+	store := NewMemoryStoreWithTestData()
+	store.tokenVersions[1] = memoryTokenVersion{version: 4, revoked: time.Now().Add(-time.Hour)}
+	store.tokenVersions[2] = memoryTokenVersion{version: 2, revoked: time.Now().Add(-time.Minute)}
+
+	versions := NewTokenVersions(store, 15*time.Minute)
+	if versions.Revoked(2, 1) {
+		t.Error("revoked before the first refresh")
+	}
+	if err := versions.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		userID  int
+		version int
+		revoked bool
+	}{
+		{"older version", 2, 1, true},
+		{"current version", 2, 2, false},
+		{"revoked longer ago than the TTL", 1, 3, false}, // Such a token has expired anyway
+		{"never revoked", 3, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if revoked := versions.Revoked(tt.userID, tt.version); revoked != tt.revoked {
+				t.Errorf("Revoked(%d, %d) = %v, want %v", tt.userID, tt.version, revoked, tt.revoked)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package themepark
+
+import (
+	"fmt"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Limits of the request payloads
+const (
+	maxBodySize          = 1 << 20 // Bytes of a JSON body
+	maxNameLength        = 100
+	maxCityLength        = 100
+	maxDescriptionLength = 2000
+	maxURLLength         = 2048
+	maxCommentLength     = 2000
+	maxCategoryLength    = 50
+	maxHeightCm          = 300
+	maxAge               = 120
+	maxDurationSeconds   = 24 * 60 * 60
+	maxCapacityPerHour   = 100000
+	maxNoteLength        = 200
+	maxTicketPriceCents  = 10000000
+)
+
+// ValidationErrors are the errors of every field that failed in a payload, returned at once so the client
+// can fix them all. It is an ErrValidation.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func (e ValidationErrors) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// validator collects the failed fields of a payload
+type validator struct {
+	errs ValidationErrors
+}
+
+// check adds an error for the field if ok is false
+func (v *validator) check(ok bool, field string, message string) {
+	if !ok {
+		v.errs = append(v.errs, &ValidationError{Field: field, Message: message})
+	}
+}
+
+// add adds the error, if any, of a check done elsewhere like validatePassword
+func (v *validator) add(err error) {
+	if validationErr, ok := err.(*ValidationError); ok {
+		v.errs = append(v.errs, validationErr)
+	}
+}
+
+func (v *validator) required(value string, field string) {
+	v.check(strings.TrimSpace(value) != "", field, "is required")
+}
+
+func (v *validator) maxLength(value string, field string, max int) {
+	v.check(len([]rune(value)) <= max, field, fmt.Sprintf("must have at most %d characters", max))
+}
+
+// between checks that an optional number, if set, is within min and max
+func (v *validator) between(value *int, field string, min int, max int) {
+	if value != nil {
+		v.check(*value >= min && *value <= max, field, fmt.Sprintf("must be between %d and %d", min, max))
+	}
+}
+
+// categories checks that every id is one of the known categories
+func (v *validator) categories(ids []int, known map[int]bool) {
+	for i, id := range ids {
+		v.check(known[id], fmt.Sprintf("categories[%d]", i), fmt.Sprintf("unknown category %d", id))
+	}
+}
+
+// err returns the collected errors, or nil if every field is valid
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+
+	return v.errs
+}
+
+// validatePassword checks that a new password is long enough
+func validatePassword(field string, password string) error {
+	if len([]rune(password)) < minPasswordLength {
+		return &ValidationError{Field: field, Message: fmt.Sprintf("must have at least %d characters", minPasswordLength)}
+	}
+
+	return nil
+}
+
+// normalizeEmail returns an email as it is stored, trimmed and in lower case, so the same address always finds
+// the same user and the same login failures
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// validateUser checks a user payload. Email and password are only checked on registration, as they can't
+// be updated.
+func validateUser(user User, registering bool, knownCategories map[int]bool) error {
+	var v validator
+
+	v.required(user.Name, "name")
+	v.maxLength(user.Name, "name", maxNameLength)
+	if registering {
+		address, err := mail.ParseAddress(user.Email)
+		v.check(err == nil && address.Address == user.Email, "email", "must be a valid email address")
+		v.add(validatePassword("password", user.Password))
+	}
+	v.check(!user.BirthDate.IsZero(), "birth_date", "is required")
+	v.check(!user.BirthDate.After(time.Now()), "birth_date", "must not be in the future")
+	v.maxLength(user.City, "city", maxCityLength)
+	v.maxLength(user.ProfilePicture, "profile_picture", maxURLLength)
+	v.maxLength(user.Description, "description", maxDescriptionLength)
+	v.categories(user.Categories, knownCategories)
+
+	return v.err()
+}
+
+// validateThemePark checks a theme park payload
+func validateThemePark(themePark ThemePark, knownCategories map[int]bool) error {
+	var v validator
+
+	v.required(themePark.Name, "name")
+	v.maxLength(themePark.Name, "name", maxNameLength)
+	v.maxLength(themePark.Description, "description", maxDescriptionLength)
+	v.maxLength(themePark.Picture, "picture", maxURLLength)
+	v.check(themePark.Latitude >= -90 && themePark.Latitude <= 90, "latitude", "must be between -90 and 90")
+	v.check(themePark.Longitude >= -180 && themePark.Longitude <= 180, "longitude", "must be between -180 and 180")
+
+	ids := make([]int, len(themePark.Categories))
+	for i, category := range themePark.Categories {
+		ids[i] = category.Id
+	}
+	v.categories(ids, knownCategories)
+
+	return v.err()
+}
+
+// validateComment checks a comment payload. The park is checked by the store.
+func validateComment(comment Comment) error {
+	var v validator
+
+	v.check(comment.ThemeparkId > 0, "themepark_id", "is required")
+	v.required(comment.Comment, "comment")
+	v.maxLength(comment.Comment, "comment", maxCommentLength)
+
+	return v.err()
+}
+
+// validateCategory checks a category payload
+func validateCategory(category Category) error {
+	var v validator
+
+	v.required(category.Name, "name")
+	v.maxLength(category.Name, "name", maxCategoryLength)
+
+	return v.err()
+}
+
+// validateAttraction checks an attraction payload of the given park. The park is the one of the path, so
+// a different themepark_id in the payload is an error instead of moving the attraction.
+func validateAttraction(attraction Attraction, parkID int) error {
+	var v validator
+
+	v.required(attraction.Name, "name")
+	v.maxLength(attraction.Name, "name", maxNameLength)
+	v.check(attraction.ThemeparkId == 0 || attraction.ThemeparkId == parkID, "themepark_id", "must be the park of the path")
+	v.check(slices.Contains(AttractionTypes, attraction.Type), "type", "must be one of "+strings.Join(AttractionTypes, ", "))
+	v.check(slices.Contains(AttractionStatuses, attraction.Status), "status", "must be one of "+strings.Join(AttractionStatuses, ", "))
+	v.between(attraction.MinHeight, "min_height_cm", 1, maxHeightCm)
+	v.between(attraction.MaxHeight, "max_height_cm", 1, maxHeightCm)
+	if attraction.MinHeight != nil && attraction.MaxHeight != nil {
+		v.check(*attraction.MinHeight <= *attraction.MaxHeight, "max_height_cm", "must not be lower than min_height_cm")
+	}
+	v.between(attraction.MinAge, "min_age", 1, maxAge)
+	v.between(attraction.ThrillLevel, "thrill_level", 1, 5)
+	v.between(attraction.Duration, "duration_seconds", 1, maxDurationSeconds)
+	v.between(attraction.CapacityPerHour, "capacity_per_hour", 1, maxCapacityPerHour)
+
+	return v.err()
+}
+
+// validateWaitTime checks a wait time report payload
+func validateWaitTime(waitTime WaitTimeRequest) error {
+	var v validator
+
+	v.check(waitTime.WaitMinutes != nil, "wait_minutes", "is required")
+	v.between(waitTime.WaitMinutes, "wait_minutes", 0, maxWaitMinutes)
+
+	return v.err()
+}
+
+// validateTicketPrice checks a ticket price payload of the park of the path
+func validateTicketPrice(price TicketPrice, parkID int) error {
+	var v validator
+
+	v.check(price.ThemeparkId == 0 || price.ThemeparkId == parkID, "themepark_id", "must be the park of the path")
+	v.check(slices.Contains(TicketTiers, price.Tier), "tier", "must be one of "+strings.Join(TicketTiers, ", "))
+	v.check(price.AmountCents != nil, "amount_cents", "is required")
+	v.between(price.AmountCents, "amount_cents", 0, maxTicketPriceCents)
+	v.check(validCurrency(price.Currency), "currency", "must be an ISO 4217 code, e.g. EUR")
+
+	_, fromErr := time.Parse(dateLayout, price.ValidFrom)
+	v.check(price.ValidFrom == "" || fromErr == nil, "valid_from", "must be a date as YYYY-MM-DD")
+	_, toErr := time.Parse(dateLayout, price.ValidTo)
+	v.check(price.ValidTo == "" || toErr == nil, "valid_to", "must be a date as YYYY-MM-DD")
+	if price.ValidFrom != "" && price.ValidTo != "" && fromErr == nil && toErr == nil {
+		v.check(price.ValidFrom <= price.ValidTo, "valid_to", "must not be before valid_from")
+	}
+
+	return v.err()
+}
+
+// validateCalendar checks a park calendar payload
+func validateCalendar(calendar ParkCalendar) error {
+	var v validator
+
+	_, err := time.LoadLocation(calendar.TimeZone)
+	v.check(calendar.TimeZone != "" && err == nil, "time_zone", "must be an IANA time zone, e.g. Europe/Madrid")
+
+	for i, hours := range calendar.Weekly {
+		field := fmt.Sprintf("weekly[%d]", i)
+		_, ok := parseWeekday(hours.Weekday)
+		v.check(ok, field+".weekday", "must be a day of the week, e.g. monday")
+		v.openingHours(field, hours.Opens, hours.Closes)
+	}
+
+	closedDates := map[string]bool{}
+	openDates := map[string]bool{}
+	for i, exception := range calendar.Exceptions {
+		field := fmt.Sprintf("exceptions[%d]", i)
+		_, err := time.Parse(dateLayout, exception.Date)
+		v.check(err == nil, field+".date", "must be a date as YYYY-MM-DD")
+		v.maxLength(exception.Note, field+".note", maxNoteLength)
+
+		if exception.Closed {
+			v.check(exception.Opens == "" && exception.Closes == "", field, "closed dates can't have opening hours")
+			v.check(!openDates[exception.Date], field, "the date also has opening hours")
+			closedDates[exception.Date] = true
+		} else {
+			v.openingHours(field, exception.Opens, exception.Closes)
+			v.check(!closedDates[exception.Date], field, "the date is also closed")
+			openDates[exception.Date] = true
+		}
+	}
+
+	return v.err()
+}
+
+// openingHours checks that a park opens before it closes, the same day
+func (v *validator) openingHours(field string, opens string, closes string) {
+	opensAt, opensErr := parseClock(opens)
+	v.check(opensErr == nil && opensAt < 24*60, field+".opens", errInvalidClock.Error())
+	closesAt, closesErr := parseClock(closes)
+	v.check(closesErr == nil, field+".closes", errInvalidClock.Error())
+
+	if opensErr == nil && closesErr == nil {
+		v.check(opensAt < closesAt, field+".closes", "must be after opens, the same day")
+	}
+}
@@ -0,0 +1,197 @@
+package themepark
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Wait times are computed from the reports of the users. The current estimate only uses the recent reports,
+// weighting the newer ones more, and the history averages the reports of the last weeks by hour and weekday.
+// In both, reports far from the rest are left out as mistakes or trolling. The DatabaseStore computes the history
+// in SQL, see waitHistoryQuery, so it must follow the same rules as waitTimesOf.
+const (
+	recentWaitWindow  = 30 * time.Minute
+	waitHalfLife      = 10 * time.Minute // A report this old weighs half as much as a new one
+	waitHistoryWindow = 8 * 7 * 24 * time.Hour
+	maxWaitMinutes    = 600
+
+	// Reports further than outlierMADs median absolute deviations from the median are outliers, but never the
+	// ones within minOutlierMinutes, so identical reports don't make every other one an outlier
+	outlierMADs       = 3
+	minOutlierMinutes = 5
+)
+
+// waitTimesOf computes the wait times of an attraction from its reports, with the history in the time zone of its park
+func waitTimesOf(reports []WaitTimeReport, location *time.Location, now time.Time) *WaitTimes {
+	if len(reports) == 0 {
+		return nil
+	}
+
+	var waitTimes WaitTimes
+	waitTimes.Current = recentWaitTime(reports, now)
+
+	byHour := map[int][]WaitTimeReport{}
+	byWeekday := map[time.Weekday][]WaitTimeReport{}
+	for _, report := range reports {
+		if now.Sub(report.Created) > waitHistoryWindow {
+			continue
+		}
+		created := report.Created.In(location)
+		byHour[created.Hour()] = append(byHour[created.Hour()], report)
+		byWeekday[created.Weekday()] = append(byWeekday[created.Weekday()], report)
+	}
+
+	for hour := 0; hour < 24; hour++ {
+		if average, count := averageWaitTime(withoutOutliers(byHour[hour])); count > 0 {
+			waitTimes.ByHour = append(waitTimes.ByHour, HourWaitTime{Hour: hour, AverageMinutes: average, Reports: count})
+		}
+	}
+	for i := 1; i <= 7; i++ {
+		weekday := time.Weekday(i % 7) // From Monday to Sunday
+		if average, count := averageWaitTime(withoutOutliers(byWeekday[weekday])); count > 0 {
+			waitTimes.ByWeekday = append(waitTimes.ByWeekday, WeekdayWaitTime{Weekday: weekdayName(weekday), AverageMinutes: average, Reports: count})
+		}
+	}
+
+	return &waitTimes
+}
+
+// weekdayName returns the name of a weekday as used in the API, e.g. "monday"
+func weekdayName(weekday time.Weekday) string {
+	return strings.ToLower(weekday.String())
+}
+
+// parkLocation returns the time zone of a park, UTC if it isn't a valid one
+func parkLocation(timeZone string) *time.Location {
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return location
+}
+
+// attachWaitTimes sets the wait times of every attraction from the reports of all of them
+func attachWaitTimes(attractions []Attraction, reports []WaitTimeReport, location *time.Location, now time.Time) {
+	byAttraction := map[int][]WaitTimeReport{}
+	for _, report := range reports {
+		byAttraction[report.AttractionId] = append(byAttraction[report.AttractionId], report)
+	}
+
+	for i := range attractions {
+		attractions[i].WaitTimes = waitTimesOf(byAttraction[attractions[i].Id], location, now)
+	}
+}
+
+// recentWaitTime returns the current wait time from the reports within recentWaitWindow, nil if there are none
+func recentWaitTime(reports []WaitTimeReport, now time.Time) *WaitTimeEstimate {
+	var recent []WaitTimeReport
+	for _, report := range reports {
+		if now.Sub(report.Created) <= recentWaitWindow {
+			recent = append(recent, report)
+		}
+	}
+
+	return currentWaitTime(withoutOutliers(latestPerUser(recent)), now)
+}
+
+// latestPerUser keeps only the latest report of every user, so one user posting many reports counts as one.
+// Reports of deleted users, without user, are all kept.
+func latestPerUser(reports []WaitTimeReport) []WaitTimeReport {
+	latest := map[int]int{} // user id -> index in the result
+	var result []WaitTimeReport
+	for _, report := range reports {
+		i, ok := latest[report.UserId]
+		switch {
+		case !ok || report.UserId == 0:
+			latest[report.UserId] = len(result)
+			result = append(result, report)
+		case report.Created.After(result[i].Created):
+			result[i] = report
+		}
+	}
+
+	return result
+}
+
+// currentWaitTime returns the average of the reports, weighted by how recent they are
+func currentWaitTime(reports []WaitTimeReport, now time.Time) *WaitTimeEstimate {
+	if len(reports) == 0 {
+		return nil
+	}
+
+	var sum, weights float64
+	var lastReport time.Time
+	for _, report := range reports {
+		weight := math.Pow(0.5, float64(now.Sub(report.Created))/float64(waitHalfLife))
+		sum += weight * float64(report.WaitMinutes)
+		weights += weight
+		if report.Created.After(lastReport) {
+			lastReport = report.Created
+		}
+	}
+
+	return &WaitTimeEstimate{
+		Minutes:    int(math.Round(sum / weights)),
+		Reports:    len(reports),
+		LastReport: lastReport,
+	}
+}
+
+// averageWaitTime returns the average of the reports, rounded to one decimal, and how many there are
+func averageWaitTime(reports []WaitTimeReport) (float64, int) {
+	if len(reports) == 0 {
+		return 0, 0
+	}
+
+	var sum float64
+	for _, report := range reports {
+		sum += float64(report.WaitMinutes)
+	}
+
+	return math.Round(sum/float64(len(reports))*10) / 10, len(reports)
+}
+
+// withoutOutliers leaves out the reports too far from the median, using the median absolute deviation, which
+// unlike the standard deviation isn't moved by the outliers themselves
+func withoutOutliers(reports []WaitTimeReport) []WaitTimeReport {
+	if len(reports) < 3 {
+		return reports
+	}
+
+	minutes := make([]float64, len(reports))
+	for i, report := range reports {
+		minutes[i] = float64(report.WaitMinutes)
+	}
+	med := median(minutes)
+
+	deviations := make([]float64, len(minutes))
+	for i, m := range minutes {
+		deviations[i] = math.Abs(m - med)
+	}
+	// 1.4826 makes the MAD comparable to a standard deviation for normal data
+	limit := max(outlierMADs*1.4826*median(deviations), minOutlierMinutes)
+
+	var inliers []WaitTimeReport
+	for i, report := range reports {
+		if deviations[i] <= limit {
+			inliers = append(inliers, report)
+		}
+	}
+
+	return inliers
+}
+
+func median(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+
+	return sorted[middle]
+}
@@ -0,0 +1,116 @@
+package themepark
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// waitTimesNow is a Tuesday, when Madrid is UTC+1
+var waitTimesNow = time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+// waitTimeReportsFixture returns reports that tell apart the outlier, time zone and per user rules.
+// Both waitTimesOf and the DatabaseStore must compute wantWaitTimes from them.
+func waitTimeReportsFixture(attractionID int) []WaitTimeReport {
+	at := func(userID int, minutes int, created time.Time) WaitTimeReport {
+		return WaitTimeReport{AttractionId: attractionID, UserId: userID, WaitMinutes: minutes, Created: created}
+	}
+	monday := time.Date(2026, 3, 9, 9, 0, 0, 0, time.UTC) // 10:00 in Madrid
+
+	return []WaitTimeReport{
+		at(1, 100, waitTimesNow.Add(-60*24*time.Hour)),           // Older than the history
+		at(1, 40, time.Date(2026, 3, 8, 23, 30, 0, 0, time.UTC)), // Sunday in UTC, but Monday 00:30 in Madrid
+		at(1, 20, monday),
+		at(2, 22, monday.Add(10*time.Minute)),
+		at(3, 24, monday.Add(20*time.Minute)),
+		at(0, 90, monday.Add(30*time.Minute)),        // Outlier, by a deleted user
+		at(1, 60, waitTimesNow.Add(-20*time.Minute)), // Replaced by the next report of the same user, and an outlier in the history
+		at(2, 34, waitTimesNow.Add(-10*time.Minute)),
+		at(1, 30, waitTimesNow.Add(-5*time.Minute)),
+	}
+}
+
+var wantWaitTimes = &WaitTimes{
+	Current: &WaitTimeEstimate{Minutes: 32, Reports: 2, LastReport: waitTimesNow.Add(-5 * time.Minute)},
+	ByHour: []HourWaitTime{
+		{Hour: 0, AverageMinutes: 40, Reports: 1},
+		{Hour: 10, AverageMinutes: 22, Reports: 3},
+		{Hour: 12, AverageMinutes: 32, Reports: 2},
+	},
+	ByWeekday: []WeekdayWaitTime{
+		{Weekday: "monday", AverageMinutes: 26.5, Reports: 4},
+		{Weekday: "tuesday", AverageMinutes: 32, Reports: 2},
+	},
+}
+
+func TestWaitTimesOf(t *testing.T) {
+	got := waitTimesOf(waitTimeReportsFixture(1), parkLocation("Europe/Madrid"), waitTimesNow)
+	checkWaitTimes(t, got, wantWaitTimes)
+
+	if got := waitTimesOf(nil, time.UTC, waitTimesNow); got != nil {
+		t.Errorf("waitTimesOf without reports = %+v, want nil", got)
+	}
+}
+
+// TestWaitHistoryQuery checks that the DatabaseStore, which computes the history with waitHistoryQuery,
+// follows the same rules as waitTimesOf
+func TestWaitHistoryQuery(t *testing.T) {
+	url := os.Getenv("THEMEPARK_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("THEMEPARK_TEST_DATABASE_URL not set")
+	}
+
+	store, err := NewDatabaseStore(url, PoolConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	attractionID, err := store.AddAttraction(ctx, Attraction{ThemeparkId: 1, Name: "Wait time test " + time.Now().Format(time.RFC3339Nano)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := store.DeleteAttraction(ctx, 1, attractionID); err != nil {
+			t.Error(err)
+		}
+	})
+
+	for _, report := range waitTimeReportsFixture(attractionID) {
+		_, err := store.pool.Exec(ctx,
+			"insert into wait_time_reports (attraction_id, user_id, wait_minutes, created) values ($1, nullif($2, 0), $3, $4)",
+			report.AttractionId, report.UserId, report.WaitMinutes, report.Created)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitTimes, err := store.waitTimes(ctx, []int{attractionID}, parkLocation("Europe/Madrid"), waitTimesNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkWaitTimes(t, waitTimes[attractionID], wantWaitTimes)
+}
+
+func checkWaitTimes(t *testing.T, got *WaitTimes, want *WaitTimes) {
+	t.Helper()
+
+	if got == nil {
+		t.Fatal("no wait times")
+	}
+	if got.Current == nil {
+		t.Error("no current wait time")
+	} else if got.Current.Minutes != want.Current.Minutes || got.Current.Reports != want.Current.Reports ||
+		!got.Current.LastReport.Equal(want.Current.LastReport) {
+		t.Errorf("current = %+v, want %+v", *got.Current, *want.Current)
+	}
+	if !reflect.DeepEqual(got.ByHour, want.ByHour) {
+		t.Errorf("by hour = %+v, want %+v", got.ByHour, want.ByHour)
+	}
+	if !reflect.DeepEqual(got.ByWeekday, want.ByWeekday) {
+		t.Errorf("by weekday = %+v, want %+v", got.ByWeekday, want.ByWeekday)
+	}
+}